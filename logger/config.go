@@ -54,6 +54,7 @@ func DummyTimeEncoder(t time.Time, enc PrimitiveArrayEncoder) {
 type Config struct {
 	name        string
 	level       *AtomicLevel
+	destLevel   *AtomicLevel
 	options     []Option
 	timeEncoder TimeEncoder
 	hostname    bool
@@ -96,6 +97,10 @@ func (c *Config) SetName(name string) *Config { c.name = name; return c }
 // SetLevel sets the logger level.
 func (c *Config) SetLevel(al *AtomicLevel) *Config { c.level = al; return c }
 
+// SetDestinationLevel sets the level of the destinations without explicit level for NewTee,
+// they are gated by the logger level alone if it's not set.
+func (c *Config) SetDestinationLevel(al *AtomicLevel) *Config { c.destLevel = al; return c }
+
 // AddOption adds a new option to config.
 func (c *Config) AddOption(option Option) *Config {
 	c.options = append(c.options, option)
@@ -0,0 +1,188 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package logger
+
+import (
+	"fmt"
+	"strings"
+
+	sofadsn "github.com/sofastack/sofa-common-go/writer/dsn"
+	"go.uber.org/zap/zapcore"
+)
+
+// filter decides whether a record goes to the destination by the logger name and fields.
+type filter struct {
+	includeLoggers []string
+	excludeLoggers []string
+	includeFields  []fieldMatcher
+	excludeFields  []fieldMatcher
+}
+
+// fieldMatcher matches the field by key, and by value if hasValue.
+type fieldMatcher struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// newFilter returns the filter configured by the dsn, it returns nil if there is no filter.
+func newFilter(d *sofadsn.DSN) *filter {
+	f := &filter{
+		includeLoggers: splitList(d.GetQuery(sofadsn.IncludeLoggerKey)),
+		excludeLoggers: splitList(d.GetQuery(sofadsn.ExcludeLoggerKey)),
+		includeFields:  parseFieldMatchers(d.GetQuery(sofadsn.IncludeFieldKey)),
+		excludeFields:  parseFieldMatchers(d.GetQuery(sofadsn.ExcludeFieldKey)),
+	}
+
+	if len(f.includeLoggers) == 0 && len(f.excludeLoggers) == 0 && !f.hasFieldRules() {
+		return nil
+	}
+
+	return f
+}
+
+func splitList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+func parseFieldMatchers(s string) []fieldMatcher {
+	var fms []fieldMatcher
+	for _, v := range splitList(s) {
+		var fm fieldMatcher
+		if i := strings.IndexByte(v, ':'); i >= 0 {
+			fm.key, fm.value, fm.hasValue = v[:i], v[i+1:], true
+		} else {
+			fm.key = v
+		}
+		fms = append(fms, fm)
+	}
+	return fms
+}
+
+func (f *filter) hasFieldRules() bool {
+	return len(f.includeFields) > 0 || len(f.excludeFields) > 0
+}
+
+// matchLogger reports whether the logger named name passes the filter.
+func (f *filter) matchLogger(name string) bool {
+	if len(f.includeLoggers) > 0 && !matchLoggerName(f.includeLoggers, name) {
+		return false
+	}
+	return !matchLoggerName(f.excludeLoggers, name)
+}
+
+func matchLoggerName(names []string, name string) bool {
+	for _, n := range names {
+		if name == n || (strings.HasPrefix(name, n) && name[len(n)] == '.') {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFields reports whether the record with the context and fields passes the filter.
+func (f *filter) matchFields(context, fields []zapcore.Field) bool {
+	if !f.hasFieldRules() {
+		return true
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	for i := range context {
+		context[i].AddTo(enc)
+	}
+	for i := range fields {
+		fields[i].AddTo(enc)
+	}
+
+	if len(f.includeFields) > 0 && !matchAnyField(f.includeFields, enc.Fields) {
+		return false
+	}
+	return !matchAnyField(f.excludeFields, enc.Fields)
+}
+
+func matchAnyField(fms []fieldMatcher, fields map[string]interface{}) bool {
+	for _, fm := range fms {
+		v, ok := fields[fm.key]
+		if !ok {
+			continue
+		}
+		if !fm.hasValue || fmt.Sprint(v) == fm.value {
+			return true
+		}
+	}
+	return false
+}
+
+// filterCore wraps the core of a destination with the logger level and the filter.
+type filterCore struct {
+	zapcore.Core
+	level   zapcore.LevelEnabler
+	filter  *filter
+	context []zapcore.Field
+}
+
+func newFilterCore(core zapcore.Core, level zapcore.LevelEnabler, f *filter) zapcore.Core {
+	return &filterCore{
+		Core:   core,
+		level:  level,
+		filter: f,
+	}
+}
+
+func (c *filterCore) Enabled(l zapcore.Level) bool {
+	return c.level.Enabled(l) && c.Core.Enabled(l)
+}
+
+func (c *filterCore) With(fields []zapcore.Field) zapcore.Core {
+	nc := &filterCore{
+		Core:   c.Core.With(fields),
+		level:  c.level,
+		filter: c.filter,
+	}
+
+	// the context is only needed to match fields
+	if c.filter != nil && c.filter.hasFieldRules() {
+		nc.context = make([]zapcore.Field, 0, len(c.context)+len(fields))
+		nc.context = append(nc.context, c.context...)
+		nc.context = append(nc.context, fields...)
+	}
+
+	return nc
+}
+
+func (c *filterCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+
+	if c.filter != nil && !c.filter.matchLogger(ent.LoggerName) {
+		return ce
+	}
+
+	return ce.AddCore(ent, c)
+}
+
+func (c *filterCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if c.filter != nil && !c.filter.matchFields(c.context, fields) {
+		return nil
+	}
+
+	return c.Core.Write(ent, fields)
+}
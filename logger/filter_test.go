@@ -0,0 +1,47 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package logger
+
+import (
+	"testing"
+
+	sofadsn "github.com/sofastack/sofa-common-go/writer/dsn"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFilter(t *testing.T) {
+	d, err := sofadsn.NewDSN("test:///filter?include_logger=app.rpc&exclude_logger=app.rpc.health" +
+		"&include_field=tenant:alipay,trace&exclude_field=debug:true")
+	require.Nil(t, err)
+
+	f := newFilter(d)
+	require.NotNil(t, f)
+
+	require.True(t, f.matchLogger("app.rpc"))
+	require.True(t, f.matchLogger("app.rpc.client"))
+	require.False(t, f.matchLogger("app.rpcx"))
+	require.False(t, f.matchLogger("app.rpc.health"))
+	require.False(t, f.matchLogger("app"))
+
+	require.True(t, f.matchFields(nil, []Field{zap.String("tenant", "alipay")}))
+	require.True(t, f.matchFields([]Field{zap.Int("trace", 1)}, nil))
+	require.False(t, f.matchFields(nil, []Field{zap.String("tenant", "taobao")}))
+	require.False(t, f.matchFields(nil, nil))
+	require.False(t, f.matchFields(nil, []Field{zap.String("tenant", "alipay"), zap.Bool("debug", true)}))
+
+	d, err = sofadsn.NewDSN("test:///filter?level=info")
+	require.Nil(t, err)
+	require.Nil(t, newFilter(d))
+}
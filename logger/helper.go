@@ -25,6 +25,8 @@ func ParseLevel(level string) Level {
 		return InfoLevel
 	case "debug":
 		return DebugLevel
+	case "warn":
+		return WarnLevel
 	case "error":
 		return ErrorLevel
 	case "dpanic":
@@ -40,6 +40,10 @@ func TestParseLevel(t *testing.T) {
 			"DEBUG",
 			DebugLevel,
 		},
+		{
+			"warn",
+			WarnLevel,
+		},
 		{
 			"error",
 			ErrorLevel,
@@ -18,6 +18,8 @@ import (
 	"io"
 	"os"
 
+	sofadsn "github.com/sofastack/sofa-common-go/writer/dsn"
+	"github.com/sofastack/sofa-common-go/writer/sofawriter"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -96,6 +98,108 @@ func New(w io.Writer, cf *Config) (*SofaLogger, error) {
 		cf.level = NewAtomicLevel(InfoLevel)
 	}
 
+	core := zapcore.NewCore(
+		newEncoder(cf),
+		zapcore.AddSync(w),
+		*cf.level,
+	)
+
+	return newLogger(core, cf), nil
+}
+
+// NewTee returns a logger which writes to every destination with the level and filters
+// of its DSN, the failure of one destination does not stop writing to the others.
+// The records are written to the destination only if they are enabled by the level of config too,
+// the destination without level in DSN is only gated by the level of config.
+func NewTee(dests []*sofawriter.Destination, cf *Config) (*SofaLogger, error) {
+	if cf == nil {
+		panic("sofalogger: config cannot be nil")
+	}
+
+	if cf.level == nil {
+		cf.level = NewAtomicLevel(DebugLevel)
+	}
+
+	enc := newEncoder(cf)
+	cores := make([]zapcore.Core, 0, len(dests))
+	for _, dest := range dests {
+		d := dest.GetDSN()
+		// the destination without explicit level is gated by the destination level of config
+		// (or the level of config alone) thus it follows the level changed at runtime
+		var level zapcore.LevelEnabler = DebugLevel
+		if l := d.GetQuery(sofadsn.LevelKey); l != "" {
+			level = ParseLevel(l)
+		} else if cf.destLevel != nil {
+			level = *cf.destLevel
+		}
+		core := newLevelCore(enc.Clone(), dest, level)
+		cores = append(cores, newFilterCore(core, *cf.level, newFilter(d)))
+	}
+
+	return newLogger(zapcore.NewTee(cores...), cf), nil
+}
+
+// levelCore is the zapcore.NewCore which writes the record with its level to the
+// destination, thus the destination degrades by level without parsing the record.
+type levelCore struct {
+	zapcore.LevelEnabler
+	enc  zapcore.Encoder
+	dest *sofawriter.Destination
+	out  zapcore.WriteSyncer
+}
+
+func newLevelCore(enc zapcore.Encoder, dest *sofawriter.Destination, enab zapcore.LevelEnabler) zapcore.Core {
+	return &levelCore{
+		LevelEnabler: enab,
+		enc:          enc,
+		dest:         dest,
+		out:          zapcore.AddSync(dest),
+	}
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &levelCore{
+		LevelEnabler: c.LevelEnabler,
+		enc:          c.enc.Clone(),
+		dest:         c.dest,
+		out:          c.out,
+	}
+	for i := range fields {
+		fields[i].AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *levelCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	_, err = c.dest.WriteLevel(int8(ent.Level), buf.Bytes())
+	buf.Free()
+	if err != nil {
+		return err
+	}
+
+	if ent.Level > zapcore.ErrorLevel {
+		// nolint
+		c.Sync()
+	}
+	return nil
+}
+
+func (c *levelCore) Sync() error {
+	return c.out.Sync()
+}
+
+func newEncoder(cf *Config) zapcore.Encoder {
 	encf := zap.NewProductionEncoderConfig()
 	if cf.timeEncoder == nil {
 		encf.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -103,12 +207,10 @@ func New(w io.Writer, cf *Config) (*SofaLogger, error) {
 		encf.EncodeTime = cf.timeEncoder
 	}
 
-	core := zapcore.NewCore(
-		zapcore.NewConsoleEncoder(encf),
-		zapcore.AddSync(w),
-		*cf.level,
-	)
+	return zapcore.NewConsoleEncoder(encf)
+}
 
+func newLogger(core zapcore.Core, cf *Config) *SofaLogger {
 	opts := []zap.Option{
 		AddCallerSkip(1),
 		zap.AddStacktrace(zap.FatalLevel),
@@ -132,17 +234,20 @@ func New(w io.Writer, cf *Config) (*SofaLogger, error) {
 		zapl = zapl.With(zap.Int("pid", os.Getpid()))
 	}
 
-	l := &SofaLogger{
+	return &SofaLogger{
 		logger: zapl,
 		sugar:  zapl.Sugar(),
 		option: cf,
 	}
-
-	return l, nil
 }
 
+// SetLevel sets the level of logger at runtime, the destinations without explicit level
+// follow it as well.
 func (l *SofaLogger) SetLevel(level Level) {
 	l.option.level.SetLevel(level)
+	if l.option.destLevel != nil {
+		l.option.destLevel.SetLevel(level)
+	}
 }
 
 func (l *SofaLogger) IsDebugLevel() bool {
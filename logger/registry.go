@@ -17,10 +17,14 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 
 	jsoniter "github.com/json-iterator/go"
 	sofadsn "github.com/sofastack/sofa-common-go/writer/dsn"
+	"github.com/sofastack/sofa-common-go/writer/pipeline"
 	"github.com/sofastack/sofa-common-go/writer/sofawriter"
 	"go.uber.org/multierr"
 )
@@ -62,6 +66,56 @@ func (r *Registry) Sync() error {
 	return multierr.Combine(errs...)
 }
 
+// Reopen reopens the files of all loggers, it cooperates with logrotate
+// which moves the file away and notifies the process.
+func (r *Registry) Reopen() error {
+	r.RLock()
+	defer r.RUnlock()
+
+	var errs []error
+	for _, k := range r.m {
+		if err := k.GetWriter().Reopen(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return multierr.Combine(errs...)
+}
+
+// ReopenOnSignal reopens all loggers once receiving any of the signals (default SIGHUP).
+// The errors of reopening are passed to the onError if it's not nil.
+// Calling the returned function stops handling the signals.
+func (r *Registry) ReopenOnSignal(onError func(error), sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	stopCh := make(chan struct{})
+	signal.Notify(sigCh, sigs...)
+
+	go func() {
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-sigCh:
+				if err := r.Reopen(); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigCh)
+			close(stopCh)
+		})
+	}
+}
+
 func (r *Registry) MarshalJSON() ([]byte, error) {
 	r.RLock()
 	defer r.RUnlock()
@@ -111,7 +165,7 @@ func (r *Registry) DoPOST(w http.ResponseWriter, req *http.Request) {
 	}
 
 	l := ParseLevel(level)
-	s.GetLevel().SetLevel(l)
+	s.SetLevel(l)
 
 	w.WriteHeader(200)
 	_, _ = w.Write([]byte(l.String()))
@@ -135,6 +189,29 @@ func (r *Registry) AllocateLogger(name string, dsn string,
 		return nil, err
 	}
 
+	return r.allocate(name, func() (*sofawriter.Writer, error) {
+		return sofawriter.NewFromDSN(d)
+	}, opts...)
+}
+
+// AllocateLoggerFromDSNList allocates a logger which writes to every DSN of dsnlist separated by sep.
+// Every DSN has its own level and filters, the level of the logger defaults to the lowest of them
+// and the records are written to a DSN only if they are enabled by both.
+// The failure of one DSN e.g. a unreachable syslog server does not stop writing to the others.
+func (r *Registry) AllocateLoggerFromDSNList(name string, dsnlist string, sep string,
+	opts ...Option) (*SofaLogger, error) {
+	dl, err := sofadsn.NewDSNList(dsnlist, sep)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.allocate(name, func() (*sofawriter.Writer, error) {
+		return sofawriter.NewFromDSNList(dl)
+	}, opts...)
+}
+
+func (r *Registry) allocate(name string, newWriter func() (*sofawriter.Writer, error),
+	opts ...Option) (*SofaLogger, error) {
 	r.Lock()
 	defer r.Unlock()
 
@@ -146,17 +223,27 @@ func (r *Registry) AllocateLogger(name string, dsn string,
 		return nil, fmt.Errorf("duplicated logger name: %s", name)
 	}
 
-	writer, err := sofawriter.NewFromDSN(d)
+	writer, err := newWriter()
 	if err != nil {
 		return nil, err
 	}
 
-	al := NewAtomicLevel(ParseLevel(writer.GetDSN().GetQuery("level")))
+	dests := writer.GetDestinations()
+	level := FatalLevel
+	for i := range dests {
+		if l := ParseLevel(dests[i].GetDSN().GetQuery(sofadsn.LevelKey)); l < level {
+			level = l
+		}
+	}
+	al := NewAtomicLevel(level)
+	// the destinations without explicit level default to info as a single DSN does
+	dl := NewAtomicLevel(InfoLevel)
 
-	logger, err := New(writer,
+	logger, err := NewTee(dests,
 		NewCallerConfig().
 			SetName(name).
 			SetLevel(al).
+			SetDestinationLevel(dl).
 			AddOptions(opts...))
 	if err != nil {
 		_ = writer.Close() // free the writer if need
@@ -186,13 +273,26 @@ func (s *SofaLoggerStatus) GetLogger() *SofaLogger { return s.logger }
 
 func (s *SofaLoggerStatus) GetLevel() *AtomicLevel { return s.level }
 
+// SetLevel sets the level of logger at runtime, the destinations without explicit level
+// follow it as well.
+func (s *SofaLoggerStatus) SetLevel(l Level) {
+	s.logger.SetLevel(l)
+}
+
 func (s *SofaLoggerStatus) GetWriter() *sofawriter.Writer { return s.writer }
 
 func (s *SofaLoggerStatus) MarshalJSON() ([]byte, error) {
+	type HistogramsStatus struct {
+		DSN        string                       `json:"dsn"`
+		Histograms *pipeline.HistogramsSnapshot `json:"histograms"`
+	}
+
 	type Status struct {
-		Name  string `json:"name"`
-		Level string `json:"level"`
-		DSN   string `json:"dsn"`
+		Name       string             `json:"name"`
+		Level      string             `json:"level"`
+		DSN        string             `json:"dsn,omitempty"`
+		DSNs       []string           `json:"dsns,omitempty"`
+		Histograms []HistogramsStatus `json:"histograms,omitempty"`
 	}
 
 	ms := &Status{}
@@ -200,7 +300,22 @@ func (s *SofaLoggerStatus) MarshalJSON() ([]byte, error) {
 	if mt, err := s.level.MarshalText(); err == nil {
 		ms.Level = string(mt)
 	}
-	ms.DSN = s.writer.GetDSN().String()
+	if d := s.writer.GetDSN(); d != nil {
+		ms.DSN = d.String()
+	}
+	if dl := s.writer.GetDSNList(); dl != nil {
+		for _, d := range dl.Get() {
+			ms.DSNs = append(ms.DSNs, d.String())
+		}
+	}
+	for _, d := range s.writer.GetDestinations() {
+		if h := d.GetHistograms(); h != nil {
+			ms.Histograms = append(ms.Histograms, HistogramsStatus{
+				DSN:        d.GetDSN().String(),
+				Histograms: h.Snapshot(),
+			})
+		}
+	}
 
 	var b bytes.Buffer
 	if err := jsoniter.NewEncoder(&b).Encode(ms); err != nil {
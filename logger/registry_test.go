@@ -0,0 +1,249 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package logger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sofastack/sofa-common-go/writer/testwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryReopenOnSignal(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "registry")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "reopen.log")
+	r := NewRegistry()
+	logger, err := r.AllocateLogger("reopen", fmt.Sprintf("file://%s", filename))
+	require.Nil(t, err)
+
+	stop := r.ReopenOnSignal(func(err error) {
+		t.Error(err)
+	}, syscall.SIGHUP)
+	defer stop()
+
+	logger.Info("before")
+	require.Nil(t, os.Rename(filename, filename+".1"))
+
+	p, err := os.FindProcess(os.Getpid())
+	require.Nil(t, err)
+	require.Nil(t, p.Signal(syscall.SIGHUP))
+
+	require.Eventually(t, func() bool {
+		logger.Info("after")
+		cc, err := ioutil.ReadFile(filename)
+		return err == nil && strings.Contains(string(cc), "after")
+	}, time.Second, 10*time.Millisecond)
+
+	cc, err := ioutil.ReadFile(filename + ".1")
+	require.Nil(t, err)
+	require.Contains(t, string(cc), "before")
+}
+
+func TestRegistryAllocateLoggerFromDSNList(t *testing.T) {
+	defer testwriter.DelAll()
+
+	r := NewRegistry()
+	logger, err := r.AllocateLoggerFromDSNList("app",
+		"test:///dl-error?trace=true&level=error"+
+			"|test:///dl-rpc?trace=true&level=debug&include_logger=app.rpc"+
+			"|test:///dl-tenant?trace=true&level=info&include_field=tenant:alipay", "|")
+	require.Nil(t, err)
+
+	s, ok := r.m["app"]
+	require.True(t, ok)
+	require.Equal(t, DebugLevel, s.GetLevel().Level())
+
+	logger.Debug("debug-app")
+	logger.Error("error-app")
+	logger.Named("rpc").Debug("debug-rpc")
+	logger.With(String("tenant", "alipay")).Info("info-alipay")
+	logger.Info("info-taobao", String("tenant", "taobao"))
+
+	buffer := func(path string) string {
+		tw, ok := testwriter.Get(path)
+		require.True(t, ok)
+		return string(tw.GetBuffer())
+	}
+
+	b := buffer("/dl-error")
+	require.Contains(t, b, "error-app")
+	require.NotContains(t, b, "debug-")
+	require.NotContains(t, b, "info-")
+
+	b = buffer("/dl-rpc")
+	require.Contains(t, b, "debug-rpc")
+	require.NotContains(t, b, "-app")
+
+	b = buffer("/dl-tenant")
+	require.Contains(t, b, "info-alipay")
+	require.NotContains(t, b, "error-app")
+	require.NotContains(t, b, "info-taobao")
+	require.NotContains(t, b, "debug-")
+
+	// the level of logger takes effect on all destinations
+	s.GetLevel().SetLevel(ErrorLevel)
+	logger.Named("rpc").Debug("debug-rpc-again")
+	require.NotContains(t, buffer("/dl-rpc"), "debug-rpc-again")
+
+	js, err := s.MarshalJSON()
+	require.Nil(t, err)
+	require.Contains(t, string(js), `"dsns":[`)
+	require.NotContains(t, string(js), `"dsn":`)
+}
+
+func TestRegistryStatusRedactSecrets(t *testing.T) {
+	defer testwriter.DelAll()
+
+	r := NewRegistry()
+	_, err := r.AllocateLogger("secret", "test:///secret?lenient=true&token=s3cr3t")
+	require.Nil(t, err)
+
+	js, err := r.m["secret"].MarshalJSON()
+	require.Nil(t, err)
+	require.NotContains(t, string(js), "s3cr3t")
+	require.Contains(t, string(js), "token=xxxxx")
+}
+
+func TestRegistryStatusHistograms(t *testing.T) {
+	defer testwriter.DelAll()
+
+	r := NewRegistry()
+	logger, err := r.AllocateLogger("hist", "test:///hist?async=true&async_histograms=true")
+	require.Nil(t, err)
+	logger.Info("hello")
+
+	h := r.m["hist"].GetWriter().GetDestinations()[0].GetHistograms()
+	require.NotNil(t, h)
+	require.Eventually(t, func() bool {
+		return h.Snapshot().WriteDuration.Count == 1
+	}, time.Second, time.Millisecond)
+
+	js, err := r.m["hist"].MarshalJSON()
+	require.Nil(t, err)
+	require.Contains(t, string(js), `"histograms":[{"dsn":"test:///hist?async=true\u0026async_histograms=true"`)
+	require.Contains(t, string(js), `"records_per_flush":{"count":1,"sum":1,"min":1,"max":1`)
+
+	_, err = r.AllocateLogger("nohist", "test:///nohist?async=true")
+	require.Nil(t, err)
+	js, err = r.m["nohist"].MarshalJSON()
+	require.Nil(t, err)
+	require.NotContains(t, string(js), "histograms")
+}
+
+func TestRegistrySetLevelAtRuntime(t *testing.T) {
+	defer testwriter.DelAll()
+
+	r := NewRegistry()
+	logger, err := r.AllocateLogger("runtime", "test:///runtime?trace=true")
+	require.Nil(t, err)
+
+	buffer := func() string {
+		tw, ok := testwriter.Get("/runtime")
+		require.True(t, ok)
+		return string(tw.GetBuffer())
+	}
+
+	logger.Debug("debug-before")
+	require.NotContains(t, buffer(), "debug-before")
+
+	rec := httptest.NewRecorder()
+	r.DoPOST(rec, httptest.NewRequest(http.MethodPost, "/?name=runtime&level=debug", nil))
+	require.Equal(t, 200, rec.Code)
+
+	logger.Debug("debug-after")
+	require.Contains(t, buffer(), "debug-after")
+
+	// the explicit level of destination is kept
+	_, err = r.AllocateLoggerFromDSNList("tee", "test:///tee-error?trace=true&level=error|test:///tee-any?trace=true", "|")
+	require.Nil(t, err)
+	rec = httptest.NewRecorder()
+	r.DoPOST(rec, httptest.NewRequest(http.MethodPost, "/?name=tee&level=debug", nil))
+	require.Equal(t, 200, rec.Code)
+
+	tee, ok := r.GetLogger("tee")
+	require.True(t, ok)
+	tee.Debug("debug-tee")
+	tw, ok := testwriter.Get("/tee-any")
+	require.True(t, ok)
+	require.Contains(t, string(tw.GetBuffer()), "debug-tee")
+	tw, ok = testwriter.Get("/tee-error")
+	require.True(t, ok)
+	require.NotContains(t, string(tw.GetBuffer()), "debug-tee")
+
+	// the destination without explicit level defaults to info even if a sibling is debug
+	_, err = r.AllocateLoggerFromDSNList("mixed", "test:///mixed-debug?trace=true&level=debug|test:///mixed-any?trace=true", "|")
+	require.Nil(t, err)
+	mixed, ok := r.GetLogger("mixed")
+	require.True(t, ok)
+	mixed.Debug("debug-mixed")
+	mixed.Info("info-mixed")
+	tw, ok = testwriter.Get("/mixed-debug")
+	require.True(t, ok)
+	require.Contains(t, string(tw.GetBuffer()), "debug-mixed")
+	tw, ok = testwriter.Get("/mixed-any")
+	require.True(t, ok)
+	require.NotContains(t, string(tw.GetBuffer()), "debug-mixed")
+	require.Contains(t, string(tw.GetBuffer()), "info-mixed")
+
+	// and it follows the level changed at runtime
+	rec = httptest.NewRecorder()
+	r.DoPOST(rec, httptest.NewRequest(http.MethodPost, "/?name=mixed&level=debug", nil))
+	require.Equal(t, 200, rec.Code)
+	mixed.Debug("debug-mixed-after")
+	require.Contains(t, string(tw.GetBuffer()), "debug-mixed-after")
+
+	rec = httptest.NewRecorder()
+	r.DoPOST(rec, httptest.NewRequest(http.MethodPost, "/?name=mixed&level=warn", nil))
+	require.Equal(t, 200, rec.Code)
+	mixed.Info("info-mixed-after")
+	require.NotContains(t, string(tw.GetBuffer()), "info-mixed-after")
+}
+
+func TestSofaLoggerSetLevelDestinations(t *testing.T) {
+	defer testwriter.DelAll()
+
+	r := NewRegistry()
+	logger, err := r.AllocateLoggerFromDSNList("direct",
+		"test:///direct-error?trace=true&level=error|test:///direct-any?trace=true", "|")
+	require.Nil(t, err)
+
+	// the destinations without explicit level follow SofaLogger.SetLevel too
+	logger.SetLevel(DebugLevel)
+	logger.Debug("debug-direct")
+	tw, ok := testwriter.Get("/direct-any")
+	require.True(t, ok)
+	require.Contains(t, string(tw.GetBuffer()), "debug-direct")
+	tw, ok = testwriter.Get("/direct-error")
+	require.True(t, ok)
+	require.NotContains(t, string(tw.GetBuffer()), "debug-direct")
+
+	logger.SetLevel(WarnLevel)
+	logger.Info("info-direct")
+	tw, ok = testwriter.Get("/direct-any")
+	require.True(t, ok)
+	require.NotContains(t, string(tw.GetBuffer()), "info-direct")
+	require.Equal(t, WarnLevel, r.m["direct"].GetLevel().Level())
+}
@@ -1,5 +0,0 @@
-package workerpool
-
-import "sync"
-
-var workerSyncPool sync.Pool
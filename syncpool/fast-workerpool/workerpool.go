@@ -1,11 +1,19 @@
 package workerpool
 
 import (
+	"context"
+	"errors"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	// ErrStopped indicates the worker pool was stopped.
+	ErrStopped = errors.New("workerpool: worker pool was stopped")
+)
+
 var workerChanCap int
 
 func init() {
@@ -16,17 +24,47 @@ func init() {
 	}
 }
 
-// WorkerPool holds the pool of worker
-type WorkerPool struct {
+// WorkerPool holds the pool of worker which serves the interface{} jobs by Handler,
+// it's the Pool of interface{} jobs without result.
+type WorkerPool = Pool[interface{}, struct{}]
+
+// Pool holds the pool of worker which serves the jobs of T by the handler returning R,
+// the jobs without result can use struct{} as R.
+type Pool[T, R any] struct {
 	sync.Mutex
 	stopCh       chan struct{}
-	handler      Handler
+	handler      func(T) (R, error)
 	workersCount int
-	workers      []*worker
+	workers      []*worker[T, R]
+	workerPool   sync.Pool
 
 	mustStop              bool
+	stopped               bool
 	maxIdleWorkerDuration time.Duration
 	maxWorkersCount       int
+
+	// queue is the optional job queue used once all of workers are busy
+	queue jobQueue[T, R]
+	// space is closed once a worker is free or a queued job is served
+	space chan struct{}
+
+	// slots are the sticky queues of ServeKeyed
+	slots          []keyedSlot[T, R]
+	numSlots       int
+	keyedQueueSize int
+
+	// resizeCh notifies the reaper once the worker pool was resized
+	resizeCh chan struct{}
+	policy   ScalingPolicy
+
+	panicHandler PanicHandler
+	errorHandler ErrorHandler
+	numPanics    uint64
+	numErrors    uint64
+	numServed    uint64
+	numRejected  uint64
+	numReaped    uint64
+	jobDuration  uint64
 }
 
 // Handler represents the worker handler function
@@ -42,22 +80,98 @@ func (h HandlerFunc) ServeJob(v interface{}) {
 	h(v)
 }
 
-type worker struct {
+// HandlerE represents the worker handler which reports the error of job
+type HandlerE interface {
+	Handler
+	ServeJobE(v interface{}) error
+}
+
+// HandlerFuncE wraps the handler which returns the error of job
+type HandlerFuncE func(v interface{}) error
+
+// ServeJob serves the job and ignores the error
+func (h HandlerFuncE) ServeJob(v interface{}) {
+	_ = h(v)
+}
+
+// ServeJobE serves the job and returns the error
+func (h HandlerFuncE) ServeJobE(v interface{}) error {
+	return h(v)
+}
+
+// PanicHandler is called with the job and the recovered value once the handler panics.
+type PanicHandler func(v interface{}, r interface{})
+
+// ErrorHandler is called with the job and the error once the handler fails.
+type ErrorHandler func(v interface{}, err error)
+
+// job is the job of T and its future which is nil if the result is not wanted,
+// the job of slot drains the sticky queue of ServeKeyed.
+type job[T, R any] struct {
+	v      T
+	future *Future[R]
+	slot   *keyedSlot[T, R]
+	exit   bool
+	// uncounted indicates the exiting worker was already uncounted by SetMaxWorkers
+	uncounted bool
+}
+
+type worker[T, R any] struct {
 	lasted time.Time
-	ch     chan interface{}
+	ch     chan job[T, R]
 }
 
 // New returns the worker pool by options
 func New(worker Handler, options ...WorkerPoolOptionSetterFunc) (*WorkerPool, error) {
+	serve := func(v interface{}) (struct{}, error) {
+		worker.ServeJob(v)
+		return struct{}{}, nil
+	}
+	if h, ok := worker.(HandlerE); ok {
+		serve = func(v interface{}) (struct{}, error) {
+			return struct{}{}, h.ServeJobE(v)
+		}
+	}
+
 	wp := &WorkerPool{
-		handler: worker,
-		stopCh:  make(chan struct{}),
+		handler: serve,
 	}
 
 	for _, op := range options {
 		op(wp)
 	}
 
+	wp.init()
+	return wp, nil
+}
+
+// NewPool returns the worker pool of T by options, the options are set on a WorkerPool
+// and copied to the pool of T.
+func NewPool[T, R any](handler func(T) (R, error), options ...WorkerPoolOptionSetterFunc) (*Pool[T, R], error) {
+	o := &WorkerPool{}
+	for _, op := range options {
+		op(o)
+	}
+
+	wp := &Pool[T, R]{
+		handler:               handler,
+		mustStop:              o.mustStop,
+		maxIdleWorkerDuration: o.maxIdleWorkerDuration,
+		maxWorkersCount:       o.maxWorkersCount,
+		queue:                 jobQueue[T, R]{size: o.queue.size},
+		numSlots:              o.numSlots,
+		keyedQueueSize:        o.keyedQueueSize,
+		policy:                o.policy,
+		panicHandler:          o.panicHandler,
+		errorHandler:          o.errorHandler,
+	}
+
+	wp.init()
+	return wp, nil
+}
+
+// init sets the default options and allocates the worker pool.
+func (wp *Pool[T, R]) init() {
 	if wp.maxIdleWorkerDuration <= 0 {
 		wp.maxIdleWorkerDuration = 10 * time.Second
 	}
@@ -66,152 +180,328 @@ func New(worker Handler, options ...WorkerPoolOptionSetterFunc) (*WorkerPool, er
 		wp.maxWorkersCount = runtime.NumCPU() * 2
 	}
 
-	return wp, nil
+	if wp.numSlots <= 0 {
+		wp.numSlots = wp.maxWorkersCount
+	}
+
+	wp.slots = make([]keyedSlot[T, R], wp.numSlots)
+	wp.resizeCh = make(chan struct{}, 1)
+}
+
+// GetPanics returns the number of jobs which panicked
+func (wp *Pool[T, R]) GetPanics() uint64 {
+	return atomic.LoadUint64(&wp.numPanics)
+}
+
+// GetErrors returns the number of jobs which failed
+func (wp *Pool[T, R]) GetErrors() uint64 {
+	return atomic.LoadUint64(&wp.numErrors)
 }
 
-// Serve dispatchs the worker to worker
-func (wp *WorkerPool) Serve(v interface{}) bool {
-	ch, ok := wp.getWorker()
+// Serve dispatchs the job to worker, it's queued if all of workers are busy and
+// the job queue is enabled. It returns false if it cannot be served.
+func (wp *Pool[T, R]) Serve(v T) bool {
+	return wp.ServePriority(PriorityNormal, v)
+}
+
+// schedule dispatchs the job to an idle or new worker otherwise queues it, it returns
+// the channel which is closed once it's worth retrying if failed and wait.
+func (wp *Pool[T, R]) schedule(p Priority, j job[T, R], wait bool) (bool, <-chan struct{}, error) {
+	wp.Lock()
+	if wp.stopped {
+		wp.Unlock()
+		return false, nil, ErrStopped
+	}
+
+	w, ok := wp.takeWorker()
 	if !ok {
-		return false
+		if wp.queue.push(p, j) {
+			wp.Unlock()
+			return true, nil, nil
+		}
+
+		var space chan struct{}
+		if wait {
+			if wp.space == nil {
+				wp.space = make(chan struct{})
+			}
+			space = wp.space
+		}
+		wp.Unlock()
+		return false, space, nil
 	}
-	ch.ch <- v
-	return true
+	wp.Unlock()
+
+	if w == nil {
+		w = wp.spawnWorker()
+	}
+	w.ch <- j
+	return true, nil, nil
 }
 
-// Start starts the number of workers to wait workers
-func (wp *WorkerPool) Start() {
-	go wp.start()
+// Start starts the reaper of idle workers, it restarts the worker pool if it was stopped.
+func (wp *Pool[T, R]) Start() {
+	wp.Lock()
+	defer wp.Unlock()
+
+	wp.stopped = false
+	if wp.stopCh != nil {
+		return
+	}
+	wp.stopCh = make(chan struct{})
+	go wp.start(wp.stopCh)
 }
 
-// Stop stops all workers
-func (wp *WorkerPool) Stop() {
-	close(wp.stopCh)
-	wp.stopCh = nil
+// Stop stops all workers immediately, the queued jobs (including the jobs of ServeKeyed) are
+// dropped and the busy workers exit once the jobs are served. The futures of the dropped jobs
+// are completed by ErrStopped. It's safe to call Stop many times.
+func (wp *Pool[T, R]) Stop() {
+	wp.Lock()
+	if !wp.stop() {
+		wp.Unlock()
+		return
+	}
+	dropped := wp.queue.reset(nil)
+	wp.Unlock()
+
+	wp.resetKeyed(dropped)
+}
+
+// Shutdown stops the worker pool gracefully: the new jobs are rejected by ErrStopped and
+// it waits until the queued and in-flight jobs are served or ctx is done.
+func (wp *Pool[T, R]) Shutdown(ctx context.Context) error {
+	wp.Lock()
+	wp.stop()
+	for wp.workersCount > 0 {
+		if wp.space == nil {
+			wp.space = make(chan struct{})
+		}
+		space := wp.space
+		wp.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-space:
+		}
+
+		wp.Lock()
+	}
+	wp.Unlock()
+	return nil
+}
 
+// IsStopped indicates whether the worker pool was stopped.
+func (wp *Pool[T, R]) IsStopped() bool {
 	wp.Lock()
+	stopped := wp.stopped
+	wp.Unlock()
+	return stopped
+}
+
+// stop rejects the new jobs and stops the idle workers, it must be called with the lock.
+// It returns false if it was already stopped.
+func (wp *Pool[T, R]) stop() bool {
+	if wp.stopped {
+		return false
+	}
+	wp.stopped = true
+
+	if wp.stopCh != nil {
+		close(wp.stopCh)
+		wp.stopCh = nil
+	}
+
 	workers := wp.workers
 	for i := range workers {
 		worker := workers[i]
-		worker.ch <- nil
+		worker.ch <- job[T, R]{exit: true}
 		workers[i] = nil
 	}
 	wp.workers = workers[:0]
-	wp.mustStop = true
-	wp.Unlock()
+
+	// wake up the waiters of ServeContext
+	wp.signal()
+	return true
 }
 
-func (wp *WorkerPool) start() {
-	idleWorkers := make([]*worker, 0, wp.maxWorkersCount)
+// start runs the reaper which stops the idle workers and warms up the workers of scaling
+// policy on every tick, it reacts to the resizes and Stop immediately.
+func (wp *Pool[T, R]) start(stopCh chan struct{}) {
+	d := wp.getMaxIdleWorkerDuration()
+	ticker := time.NewTicker(d)
+	defer func() {
+		ticker.Stop()
+	}()
+
+	var idleWorkers []*worker[T, R]
 	for {
+		idleWorkers = wp.reap(idleWorkers)
+
 		select {
-		case <-wp.stopCh:
+		case <-stopCh:
 			return
-		default:
-			currentTime := time.Now()
-
-			wp.Lock()
-			workers := wp.workers
-			n := len(workers)
-			i := 0
-
-			// Find the idle workers and cleanup
-			for i < n && currentTime.Sub(workers[i].lasted) > wp.maxIdleWorkerDuration {
-				i++
+		case <-ticker.C:
+		case <-wp.resizeCh:
+			if nd := wp.getMaxIdleWorkerDuration(); nd != d {
+				d = nd
+				ticker.Stop()
+				ticker = time.NewTicker(d)
 			}
-
-			// nolint
-			idleWorkers = append(idleWorkers[:0], workers[:i]...)
-			if i > 0 {
-				m := copy(workers, workers[i:])
-				for i = m; i < n; i++ {
-					workers[i] = nil
-				}
-				wp.workers = workers[:m]
-			}
-			wp.Unlock()
-
-			for i := range idleWorkers {
-				worker := idleWorkers[i]
-				worker.ch <- nil
-				idleWorkers[i] = nil
-			}
-
-			time.Sleep(wp.maxIdleWorkerDuration)
 		}
 	}
 }
 
-// getWorkers returns a worker
-func (wp *WorkerPool) getWorker() (*worker, bool) {
-	var w *worker
-	createWorker := false
-
-	wp.Lock()
+// takeWorker takes an idle worker or returns nil worker if a new worker is allowed,
+// it must be called with the lock.
+func (wp *Pool[T, R]) takeWorker() (*worker[T, R], bool) {
 	workers := wp.workers
 	n := len(workers) - 1
 	if n < 0 {
 		if wp.workersCount < wp.maxWorkersCount {
-			createWorker = true
 			wp.workersCount++
+			return nil, true
+		}
+		return nil, false
+	}
+
+	w := workers[n]
+	workers[n] = nil
+	wp.workers = workers[:n]
+	return w, true
+}
+
+// spawnWorker starts a new worker which was counted by takeWorker
+func (wp *Pool[T, R]) spawnWorker() *worker[T, R] {
+	var w *worker[T, R]
+	v := wp.workerPool.Get()
+	if v == nil {
+		w = &worker[T, R]{
+			ch: make(chan job[T, R], workerChanCap),
 		}
 	} else {
-		w = workers[n]
-		workers[n] = nil
-		wp.workers = workers[:n]
+		w = v.(*worker[T, R])
 	}
-	wp.Unlock()
 
-	if w == nil {
-		if !createWorker {
-			return nil, false
+	go func() {
+		wp.do(w)
+		wp.workerPool.Put(w)
+	}()
+
+	return w
+}
+
+func (wp *Pool[T, R]) do(worker *worker[T, R]) {
+	counted := true
+	defer func() {
+		if !counted {
+			return
 		}
+		wp.Lock()
+		wp.workersCount--
+		wp.signal()
+		wp.Unlock()
+	}()
 
-		v := workerSyncPool.Get()
-		if v == nil {
-			w = &worker{
-				ch: make(chan interface{}, workerChanCap),
-			}
-		} else {
-			w = v.(*worker)
+	for {
+		j := <-worker.ch
+		if j.exit {
+			counted = !j.uncounted
+			break
 		}
 
-		go func() {
-			wp.do(w)
-			workerSyncPool.Put(v)
-		}()
+		if !wp.serve(worker, j) {
+			break
+		}
 	}
-
-	return w, true
 }
 
-func (wp *WorkerPool) do(worker *worker) {
+// serve serves the job and the queued jobs until the worker is put back to idle,
+// it returns false if the worker must exit.
+func (wp *Pool[T, R]) serve(worker *worker[T, R], j job[T, R]) bool {
 	for {
-		c := <-worker.ch
-		if c == nil {
-			break
+		wp.serveJob(j)
+
+		next, ok, alive := wp.release(worker)
+		if !alive {
+			return false
+		}
+		if !ok {
+			return true
 		}
+		j = next
+	}
+}
 
-		wp.handler.ServeJob(c)
+// serveJob serves the job by handler, the panic is recovered thus the worker survives
+// and the future is completed by ErrPanicked.
+func (wp *Pool[T, R]) serveJob(j job[T, R]) {
+	if j.slot != nil {
+		wp.serveKeyed(j.slot)
+		return
+	}
 
-		if !wp.release(worker) {
-			break
+	start := time.Now()
+	completed := false
+	defer func() {
+		atomic.AddUint64(&wp.jobDuration, uint64(time.Since(start)))
+		atomic.AddUint64(&wp.numServed, 1)
+
+		if !completed && j.future != nil {
+			var r R
+			j.future.complete(r, ErrPanicked)
+		}
+		if r := recover(); r != nil {
+			atomic.AddUint64(&wp.numPanics, 1)
+			if wp.panicHandler != nil {
+				wp.panicHandler(j.v, r)
+			}
 		}
+	}()
+
+	r, err := wp.handler(j.v)
+	completed = true
+	if j.future != nil {
+		j.future.complete(r, err)
 	}
 
-	wp.Lock()
-	wp.workersCount--
-	wp.Unlock()
+	if err != nil {
+		atomic.AddUint64(&wp.numErrors, 1)
+		if wp.errorHandler != nil {
+			wp.errorHandler(j.v, err)
+		}
+	}
 }
 
-func (wp *WorkerPool) release(ch *worker) bool {
-	ch.lasted = time.Now()
+// release returns the next queued job or puts the worker back to idle if there is no queued job,
+// it returns false alive if the worker must exit.
+func (wp *Pool[T, R]) release(w *worker[T, R]) (next job[T, R], ok bool, alive bool) {
+	w.lasted = time.Now()
 	wp.Lock()
-	if wp.mustStop {
+	// the worker pool was shrunk
+	if wp.workersCount > wp.maxWorkersCount {
 		wp.Unlock()
-		return false
+		return next, false, false
 	}
-	wp.workers = append(wp.workers, ch)
+	if next, ok = wp.queue.pop(); ok {
+		wp.signal()
+		wp.Unlock()
+		return next, true, true
+	}
+	if wp.mustStop || wp.stopped {
+		wp.Unlock()
+		return next, false, false
+	}
+	wp.workers = append(wp.workers, w)
+	wp.signal()
 	wp.Unlock()
-	return true
+	return next, false, true
+}
+
+// drop completes the future of the dropped job by err.
+func (j *job[T, R]) drop(err error) {
+	if j.future != nil {
+		var r R
+		j.future.complete(r, err)
+	}
 }
@@ -0,0 +1,110 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+var (
+	// ErrRejected indicates the job cannot be served because all of workers are busy
+	// and the job queue is full.
+	ErrRejected = errors.New("workerpool: job was rejected")
+
+	// ErrPanicked indicates the handler panicked while serving the job.
+	ErrPanicked = errors.New("workerpool: job panicked")
+)
+
+// Submit submits the job without blocking and returns the future of its result, the future
+// is completed by ErrRejected or ErrStopped if it cannot be served.
+func (wp *Pool[T, R]) Submit(v T) *Future[R] {
+	f := newFuture[R]()
+	ok, _, err := wp.schedule(PriorityNormal, job[T, R]{v: v, future: f}, false)
+	if !ok {
+		atomic.AddUint64(&wp.numRejected, 1)
+		if err == nil {
+			err = ErrRejected
+		}
+		var r R
+		f.complete(r, err)
+	}
+	return f
+}
+
+// SubmitContext submits the job and returns the future of its result, it blocks until the job
+// is served or queued, or ctx is done. The future is completed by the error if it cannot be served.
+func (wp *Pool[T, R]) SubmitContext(ctx context.Context, v T) *Future[R] {
+	f := newFuture[R]()
+	if err := wp.serveContext(ctx, PriorityNormal, job[T, R]{v: v, future: f}); err != nil {
+		var r R
+		f.complete(r, err)
+	}
+	return f
+}
+
+// SubmitBatch submits the jobs in order and returns their futures, it blocks until all of jobs
+// are served or queued. Once ctx is done the rest of futures are completed by ctx.Err().
+func (wp *Pool[T, R]) SubmitBatch(ctx context.Context, vs []T) []*Future[R] {
+	fs := make([]*Future[R], len(vs))
+	for i := range vs {
+		if err := ctx.Err(); err != nil {
+			var r R
+			fs[i] = newFuture[R]()
+			fs[i].complete(r, err)
+			continue
+		}
+		fs[i] = wp.SubmitContext(ctx, vs[i])
+	}
+	return fs
+}
+
+// Future is the result of the submitted job.
+type Future[R any] struct {
+	done chan struct{}
+	r    R
+	err  error
+}
+
+func newFuture[R any]() *Future[R] {
+	return &Future[R]{done: make(chan struct{})}
+}
+
+func (f *Future[R]) complete(r R, err error) {
+	f.r = r
+	f.err = err
+	close(f.done)
+}
+
+// Done returns the channel which is closed once the job was completed.
+func (f *Future[R]) Done() <-chan struct{} { return f.done }
+
+// Get blocks until the job was completed and returns its result.
+func (f *Future[R]) Get() (R, error) {
+	<-f.done
+	return f.r, f.err
+}
+
+// GetContext blocks until the job was completed or ctx is done.
+func (f *Future[R]) GetContext(ctx context.Context) (R, error) {
+	select {
+	case <-f.done:
+		return f.r, f.err
+	case <-ctx.Done():
+		var r R
+		return r, ctx.Err()
+	}
+}
+
+// WaitAll waits all of futures and returns their results in order, it returns the first error
+// of futures or ctx.Err() once ctx is done.
+func WaitAll[R any](ctx context.Context, fs []*Future[R]) ([]R, error) {
+	rs := make([]R, len(fs))
+	for i := range fs {
+		r, err := fs[i].GetContext(ctx)
+		if err != nil {
+			return rs, err
+		}
+		rs[i] = r
+	}
+	return rs, nil
+}
@@ -0,0 +1,145 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolSubmit(t *testing.T) {
+	p, err := NewPool(func(v int) (string, error) {
+		if v < 0 {
+			return "", errors.New("negative")
+		}
+		return strconv.Itoa(v), nil
+	}, WithWorkerPoolMaxWorkersCount(4), WithWorkerPoolQueueSize(16))
+	assert.Nil(t, err)
+	defer p.Stop()
+
+	r, err := p.Submit(42).Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "42", r)
+
+	_, err = p.Submit(-1).Get()
+	assert.EqualError(t, err, "negative")
+	assert.Equal(t, uint64(1), p.Stats().Errors)
+
+	vs := make([]int, 100)
+	for i := range vs {
+		vs[i] = i
+	}
+	rs, err := WaitAll(context.Background(), p.SubmitBatch(context.Background(), vs))
+	assert.Nil(t, err)
+	for i := range rs {
+		assert.Equal(t, strconv.Itoa(i), rs[i])
+	}
+
+	// the rest of batch is completed by ctx.Err() once ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = WaitAll(context.Background(), p.SubmitBatch(ctx, vs))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestPoolServe(t *testing.T) {
+	done := make(chan string, 2)
+	p, err := NewPool(func(v string) (struct{}, error) {
+		done <- v
+		return struct{}{}, nil
+	})
+	assert.Nil(t, err)
+	defer p.Stop()
+
+	assert.True(t, p.Serve("a"))
+	assert.True(t, p.ServeKeyed("k", "b"))
+	assert.ElementsMatch(t, []string{"a", "b"}, []string{<-done, <-done})
+	assert.Nil(t, p.ServeContext(context.Background(), "c"))
+	assert.Equal(t, "c", <-done)
+}
+
+func TestPoolPanicAndReject(t *testing.T) {
+	block := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	p, err := NewPool(func(v int) (int, error) {
+		if v == 0 {
+			panic("boom")
+		}
+		<-block
+		return v, nil
+	},
+		WithWorkerPoolMaxWorkersCount(1),
+		WithWorkerPoolPanicHandler(func(v interface{}, r interface{}) {
+			panicked <- v
+		}))
+	assert.Nil(t, err)
+
+	// the future is completed even if the handler panics
+	_, err = p.Submit(0).Get()
+	assert.Equal(t, ErrPanicked, err)
+	assert.Equal(t, 0, <-panicked)
+	assert.Eventually(t, func() bool {
+		s := p.Stats()
+		return s.Panics == 1 && s.IdleWorkers == 1
+	}, time.Second, time.Millisecond)
+
+	f := p.Submit(1)
+	_, err = p.Submit(2).Get()
+	assert.Equal(t, ErrRejected, err)
+	close(block)
+	r, err := f.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r)
+
+	assert.Nil(t, p.Shutdown(context.Background()))
+	_, err = p.Submit(3).Get()
+	assert.Equal(t, ErrStopped, err)
+}
+
+func TestPoolStopCompletesFutures(t *testing.T) {
+	block := make(chan struct{})
+	p, err := NewPool(func(v int) (int, error) {
+		if v == 0 {
+			<-block
+		}
+		return v, nil
+	}, WithWorkerPoolMaxWorkersCount(1), WithWorkerPoolQueueSize(4))
+	assert.Nil(t, err)
+
+	running := p.Submit(0)
+	queued := []*Future[int]{p.Submit(1), p.Submit(2)}
+	assert.Equal(t, 2, p.QueueLen())
+
+	p.Stop()
+	for _, f := range queued {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := f.GetContext(ctx)
+		cancel()
+		assert.Equal(t, ErrStopped, err)
+	}
+
+	close(block)
+	r, err := running.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, r)
+}
+
+func TestPoolOptionSetterFunc(t *testing.T) {
+	var setter WorkerPoolOptionSetterFunc = func(wp *WorkerPool) {
+		wp.maxWorkersCount = 3
+	}
+
+	p, err := NewPool(func(v int) (int, error) { return v, nil }, setter)
+	assert.Nil(t, err)
+	defer p.Stop()
+	assert.Equal(t, 3, p.maxWorkersCount)
+	assert.Equal(t, 3, len(p.slots))
+
+	wp, err := New(HandlerFunc(func(interface{}) {}), setter)
+	assert.Nil(t, err)
+	defer wp.Stop()
+	assert.Equal(t, 3, wp.maxWorkersCount)
+}
@@ -0,0 +1,138 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sofastack/sofa-common-go/helper/fnv"
+)
+
+// keyedSlot is the sticky queue of the keys hashed to it, the jobs are served in order
+// by at most one worker at the same time.
+type keyedSlot[T, R any] struct {
+	sync.Mutex
+	jobs    []job[T, R]
+	spare   []job[T, R]
+	running bool
+}
+
+// ServeKeyed serves the job in order with the other jobs of the same key while the jobs of
+// different keys are served in parallel. The key is hashed by fnv to a sticky queue which
+// is drained by one worker, thus the caller never blocks. It returns false if the queue of
+// key is full or the queue cannot be dispatched to worker.
+func (wp *Pool[T, R]) ServeKeyed(key string, v T) bool {
+	return wp.ServeKeyedPriority(PriorityNormal, key, v)
+}
+
+// ServeKeyedPriority is ServeKeyed with the priority of job queue which is used to
+// dispatch the queue of key.
+func (wp *Pool[T, R]) ServeKeyedPriority(p Priority, key string, v T) bool {
+	if wp.IsStopped() {
+		atomic.AddUint64(&wp.numRejected, 1)
+		return false
+	}
+
+	s := &wp.slots[fnv.HashAdd(fnv.HashNew(), key)%uint64(len(wp.slots))]
+
+	s.Lock()
+	if wp.keyedQueueSize > 0 && len(s.jobs) >= wp.keyedQueueSize {
+		s.Unlock()
+		atomic.AddUint64(&wp.numRejected, 1)
+		return false
+	}
+	s.jobs = append(s.jobs, job[T, R]{v: v})
+	if s.running {
+		s.Unlock()
+		return true
+	}
+	s.running = true
+	s.Unlock()
+
+	if ok, _, _ := wp.schedule(p, job[T, R]{slot: s}, false); ok {
+		return true
+	}
+	atomic.AddUint64(&wp.numRejected, 1)
+
+	// the slot was idle thus v is the first job, the others were queued while dispatching
+	s.Lock()
+	n := copy(s.jobs, s.jobs[1:])
+	s.jobs[n] = job[T, R]{}
+	s.jobs = s.jobs[:n]
+	if n == 0 {
+		s.running = false
+		s.Unlock()
+		return false
+	}
+	s.Unlock()
+
+	// the callers of the others were told true thus the slot must be dispatched
+	go wp.redispatch(p, s)
+	return false
+}
+
+// redispatch dispatches the slot by blocking until a worker is free, the queued jobs of slot
+// are dropped if the worker pool was stopped.
+func (wp *Pool[T, R]) redispatch(p Priority, s *keyedSlot[T, R]) {
+	if err := wp.serveContext(context.Background(), p, job[T, R]{slot: s}); err != nil {
+		s.reset(true)
+	}
+}
+
+// serveKeyed drains the queue of key in order, the queued jobs are swapped out in batch
+// thus ServeKeyed is not blocked while serving.
+func (wp *Pool[T, R]) serveKeyed(s *keyedSlot[T, R]) {
+	for {
+		s.Lock()
+		if len(s.jobs) == 0 {
+			s.running = false
+			s.Unlock()
+			return
+		}
+		jobs := s.jobs
+		s.jobs = s.spare[:0]
+		s.spare = nil
+		s.Unlock()
+
+		for i := range jobs {
+			wp.serveJob(jobs[i])
+			jobs[i] = job[T, R]{}
+		}
+
+		s.Lock()
+		s.spare = jobs[:0]
+		s.Unlock()
+	}
+}
+
+// resetKeyed drops the queued jobs and the jobs of keys, the slots dropped from the job
+// queue are never served thus they are not running anymore.
+func (wp *Pool[T, R]) resetKeyed(dropped []job[T, R]) {
+	for i := range dropped {
+		if s := dropped[i].slot; s != nil {
+			s.reset(true)
+			continue
+		}
+		dropped[i].drop(ErrStopped)
+	}
+
+	// the running slots are stopped by serveKeyed once it finds no job
+	for i := range wp.slots {
+		wp.slots[i].reset(false)
+	}
+}
+
+// reset drops the queued jobs of slot, the futures of them are completed by ErrStopped.
+func (s *keyedSlot[T, R]) reset(stopped bool) {
+	s.Lock()
+	jobs := s.jobs
+	s.jobs = nil
+	if stopped {
+		s.running = false
+	}
+	s.Unlock()
+
+	for j := range jobs {
+		jobs[j].drop(ErrStopped)
+	}
+}
@@ -0,0 +1,184 @@
+package workerpool
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type keyedJob struct {
+	key string
+	seq int
+}
+
+func TestWorkerPoolServeKeyed(t *testing.T) {
+	const (
+		keys  = 16
+		count = 1000
+	)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		last = make(map[string]int)
+	)
+	handler := func(v interface{}) {
+		j := v.(*keyedJob)
+		mu.Lock()
+		// the order of one key is kept
+		assert.Equal(t, last[j.key]+1, j.seq)
+		last[j.key] = j.seq
+		mu.Unlock()
+		wg.Done()
+	}
+
+	wp, err := New(HandlerFunc(handler),
+		WithWorkerPoolMaxWorkersCount(4),
+		WithWorkerPoolQueueSize(64))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	wg.Add(keys * count)
+	for k := 0; k < keys; k++ {
+		go func(k int) {
+			key := fmt.Sprintf("conn-%d", k)
+			for i := 1; i <= count; i++ {
+				j := &keyedJob{key: key, seq: i}
+				for !wp.ServeKeyed(key, j) {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}(k)
+	}
+	wg.Wait()
+
+	for k := 0; k < keys; k++ {
+		assert.Equal(t, count, last[fmt.Sprintf("conn-%d", k)])
+	}
+	assert.Equal(t, uint64(keys*count), wp.Stats().Served)
+}
+
+func TestWorkerPoolServeKeyedSerial(t *testing.T) {
+	var wg sync.WaitGroup
+	started := make(chan struct{})
+	block := make(chan struct{})
+	handler := func(v interface{}) {
+		if v.(int) == 0 {
+			close(started)
+			<-block
+		}
+		wg.Done()
+	}
+
+	wp, err := New(HandlerFunc(handler),
+		WithWorkerPoolMaxWorkersCount(4),
+		WithWorkerPoolKeyedSlots(1),
+		WithWorkerPoolKeyedQueueSize(2))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	// the jobs of the same slot are served by one worker
+	wg.Add(3)
+	assert.True(t, wp.ServeKeyed("a", 0))
+	<-started
+	assert.True(t, wp.ServeKeyed("b", 1))
+	assert.True(t, wp.ServeKeyed("a", 2))
+	s := wp.Stats()
+	assert.Equal(t, 1, s.Workers)
+	assert.Equal(t, 1, s.BusyWorkers)
+
+	// the queue of key is full
+	assert.False(t, wp.ServeKeyed("a", 3))
+
+	close(block)
+	wg.Wait()
+
+	wp.Stop()
+	assert.False(t, wp.ServeKeyed("a", 4))
+}
+
+func TestWorkerPoolServeKeyedRejectKeepsOthers(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		served = make(map[int]bool)
+	)
+	block := make(chan struct{})
+	handler := func(v interface{}) {
+		if v.(int) < 0 {
+			<-block
+			return
+		}
+		mu.Lock()
+		served[v.(int)] = true
+		mu.Unlock()
+	}
+
+	wp, err := New(HandlerFunc(handler), WithWorkerPoolMaxWorkersCount(1))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	// saturate the worker pool thus the slot of key cannot be dispatched
+	assert.True(t, wp.Serve(-1))
+
+	var (
+		wg       sync.WaitGroup
+		accepted sync.Map
+	)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				v := g*100 + i
+				if wp.ServeKeyed("k", v) {
+					accepted.Store(v, true)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(block)
+
+	// the accepted jobs are served even if the dispatch of others failed
+	accepted.Range(func(k, _ interface{}) bool {
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return served[k.(int)]
+		}, time.Second, time.Millisecond)
+		return true
+	})
+}
+
+func TestWorkerPoolServeKeyedRestart(t *testing.T) {
+	var wg sync.WaitGroup
+	block := make(chan struct{})
+	handler := func(v interface{}) {
+		if v.(int) < 0 {
+			<-block
+			return
+		}
+		wg.Done()
+	}
+
+	wp, err := New(HandlerFunc(handler),
+		WithWorkerPoolMaxWorkersCount(1),
+		WithWorkerPoolQueueSize(4))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	// the slot of key is queued then dropped by Stop
+	assert.True(t, wp.Serve(-1))
+	assert.True(t, wp.ServeKeyed("k", 1))
+	assert.Equal(t, 1, wp.QueueLen())
+	wp.Stop()
+	close(block)
+
+	wp.Start()
+	wg.Add(1)
+	assert.True(t, wp.ServeKeyed("k", 2))
+	wg.Wait()
+}
@@ -21,3 +21,48 @@ func WithWorkerPoolMustStop() WorkerPoolOptionSetterFunc {
 		wp.mustStop = true
 	}
 }
+
+// WithWorkerPoolQueueSize enables the bounded job queue which holds at most m jobs
+// once all of workers are busy.
+func WithWorkerPoolQueueSize(m int) WorkerPoolOptionSetterFunc {
+	return func(wp *WorkerPool) {
+		wp.queue.size = m
+	}
+}
+
+// WithWorkerPoolPanicHandler sets the handler which is called once the job panics,
+// the panic is always recovered and counted even if the handler is nil.
+func WithWorkerPoolPanicHandler(h PanicHandler) WorkerPoolOptionSetterFunc {
+	return func(wp *WorkerPool) {
+		wp.panicHandler = h
+	}
+}
+
+// WithWorkerPoolErrorHandler sets the handler which is called once the handler fails.
+func WithWorkerPoolErrorHandler(h ErrorHandler) WorkerPoolOptionSetterFunc {
+	return func(wp *WorkerPool) {
+		wp.errorHandler = h
+	}
+}
+
+// WithWorkerPoolScalingPolicy sets the scaling policy which decides the number of warm workers.
+func WithWorkerPoolScalingPolicy(p ScalingPolicy) WorkerPoolOptionSetterFunc {
+	return func(wp *WorkerPool) {
+		wp.policy = p
+	}
+}
+
+// WithWorkerPoolKeyedSlots sets the number of sticky queues of ServeKeyed (default max
+// workers count), the keys are hashed to them.
+func WithWorkerPoolKeyedSlots(m int) WorkerPoolOptionSetterFunc {
+	return func(wp *WorkerPool) {
+		wp.numSlots = m
+	}
+}
+
+// WithWorkerPoolKeyedQueueSize bounds each sticky queue of ServeKeyed by m jobs (default unbounded).
+func WithWorkerPoolKeyedQueueSize(m int) WorkerPoolOptionSetterFunc {
+	return func(wp *WorkerPool) {
+		wp.keyedQueueSize = m
+	}
+}
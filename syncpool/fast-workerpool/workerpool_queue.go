@@ -0,0 +1,150 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrServeTimeout indicates no worker was available before timeout.
+	ErrServeTimeout = errors.New("workerpool: serve timeout")
+)
+
+// Priority is the lane of job queue, the queued jobs of higher priority are served first.
+type Priority uint8
+
+const (
+	// PriorityHigh is the lane of latency-critical jobs.
+	PriorityHigh Priority = iota
+	// PriorityNormal is the lane of Serve and ServeContext.
+	PriorityNormal
+	// PriorityLow is the lane of bulk jobs.
+	PriorityLow
+
+	numPriorities = int(PriorityLow) + 1
+)
+
+// jobQueue is the bounded job queue of lanes, it's guarded by the lock of Pool.
+type jobQueue[T, R any] struct {
+	size  int
+	n     int
+	lanes [numPriorities][]job[T, R]
+}
+
+func (q *jobQueue[T, R]) push(p Priority, j job[T, R]) bool {
+	if q.n >= q.size {
+		return false
+	}
+	if int(p) >= numPriorities {
+		p = PriorityLow
+	}
+	q.lanes[p] = append(q.lanes[p], j)
+	q.n++
+	return true
+}
+
+// reset drops the queued jobs and appends them to dropped
+func (q *jobQueue[T, R]) reset(dropped []job[T, R]) []job[T, R] {
+	for i := range q.lanes {
+		lane := q.lanes[i]
+		dropped = append(dropped, lane...)
+		for j := range lane {
+			lane[j] = job[T, R]{}
+		}
+		q.lanes[i] = lane[:0]
+	}
+	q.n = 0
+	return dropped
+}
+
+func (q *jobQueue[T, R]) pop() (j job[T, R], ok bool) {
+	if q.n == 0 {
+		return j, false
+	}
+	for i := range q.lanes {
+		lane := q.lanes[i]
+		if len(lane) == 0 {
+			continue
+		}
+		j = lane[0]
+		lane[0] = job[T, R]{}
+		q.lanes[i] = lane[1:]
+		if len(q.lanes[i]) == 0 {
+			q.lanes[i] = lane[:0]
+		}
+		q.n--
+		return j, true
+	}
+	return j, false
+}
+
+// ServePriority serves the job without blocking, it's queued in the lane of priority if all
+// of workers are busy and the job queue is enabled. It returns false if it cannot be served.
+func (wp *Pool[T, R]) ServePriority(p Priority, v T) bool {
+	ok, _, _ := wp.schedule(p, job[T, R]{v: v}, false)
+	if !ok {
+		atomic.AddUint64(&wp.numRejected, 1)
+	}
+	return ok
+}
+
+// ServeContext serves the job, it blocks until a worker is free or the job is queued,
+// or ctx is done. It returns ErrStopped if the worker pool was stopped.
+func (wp *Pool[T, R]) ServeContext(ctx context.Context, v T) error {
+	return wp.ServeContextPriority(ctx, PriorityNormal, v)
+}
+
+// ServeContextPriority is ServeContext with the priority of job queue.
+func (wp *Pool[T, R]) ServeContextPriority(ctx context.Context, p Priority, v T) error {
+	return wp.serveContext(ctx, p, job[T, R]{v: v})
+}
+
+func (wp *Pool[T, R]) serveContext(ctx context.Context, p Priority, j job[T, R]) error {
+	for {
+		ok, space, err := wp.schedule(p, j, true)
+		if err != nil {
+			atomic.AddUint64(&wp.numRejected, 1)
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			atomic.AddUint64(&wp.numRejected, 1)
+			return ctx.Err()
+		case <-space:
+		}
+	}
+}
+
+// ServeTimeout is ServeContext with timeout, it returns ErrServeTimeout if timeout.
+func (wp *Pool[T, R]) ServeTimeout(v T, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	err := wp.ServeContext(ctx, v)
+	if err == context.DeadlineExceeded {
+		return ErrServeTimeout
+	}
+	return err
+}
+
+// QueueLen returns the number of queued jobs.
+func (wp *Pool[T, R]) QueueLen() int {
+	wp.Lock()
+	n := wp.queue.n
+	wp.Unlock()
+	return n
+}
+
+// signal wakes up the waiters of ServeContext, it must be called with the lock.
+func (wp *Pool[T, R]) signal() {
+	if wp.space != nil {
+		close(wp.space)
+		wp.space = nil
+	}
+}
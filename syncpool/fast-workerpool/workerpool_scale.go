@@ -0,0 +1,195 @@
+package workerpool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ScalingPolicy decides the number of warm workers, the reaper never stops the idle workers
+// below it and starts the workers ahead of the jobs thus the bursts don't pay the goroutine
+// startup. It's called by the reaper on every tick.
+type ScalingPolicy interface {
+	MinWorkers(s Stats) int
+}
+
+// ScalingPolicyFunc wraps the scaling policy
+type ScalingPolicyFunc func(s Stats) int
+
+// MinWorkers returns the number of warm workers
+func (f ScalingPolicyFunc) MinWorkers(s Stats) int {
+	return f(s)
+}
+
+// MinWorkersPolicy returns the scaling policy which keeps n warm workers.
+func MinWorkersPolicy(n int) ScalingPolicy {
+	return ScalingPolicyFunc(func(s Stats) int { return n })
+}
+
+// SetMaxWorkers resizes the max number of workers at runtime, the excess idle workers
+// are stopped and uncounted immediately and the busy ones exit once the jobs are served
+// if the pool is still beyond the max.
+func (wp *Pool[T, R]) SetMaxWorkers(m int) {
+	if m <= 0 {
+		return
+	}
+
+	wp.Lock()
+	wp.maxWorkersCount = m
+
+	// stop the excess idle workers from the oldest
+	workers := wp.workers
+	n := wp.workersCount - m
+	if n > len(workers) {
+		n = len(workers)
+	}
+	var excess []*worker[T, R]
+	if n > 0 {
+		excess = append(excess, workers[:n]...)
+		k := copy(workers, workers[n:])
+		for i := k; i < len(workers); i++ {
+			workers[i] = nil
+		}
+		wp.workers = workers[:k]
+		wp.workersCount -= n
+	}
+
+	// serve the queued jobs by the new workers
+	var jobs []job[T, R]
+	for wp.workersCount < m && !wp.stopped {
+		v, ok := wp.queue.pop()
+		if !ok {
+			break
+		}
+		wp.workersCount++
+		jobs = append(jobs, v)
+	}
+	wp.signal()
+	wp.Unlock()
+
+	for i := range excess {
+		excess[i].ch <- job[T, R]{exit: true, uncounted: true}
+	}
+	for i := range jobs {
+		wp.spawnWorker().ch <- jobs[i]
+	}
+
+	wp.notifyResize()
+}
+
+// SetMaxIdleWorkerDuration resizes the max duration of idle worker at runtime.
+func (wp *Pool[T, R]) SetMaxIdleWorkerDuration(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	wp.Lock()
+	wp.maxIdleWorkerDuration = d
+	wp.Unlock()
+
+	wp.notifyResize()
+}
+
+// SetScalingPolicy sets the scaling policy at runtime, nil disables the warm workers.
+func (wp *Pool[T, R]) SetScalingPolicy(p ScalingPolicy) {
+	wp.Lock()
+	wp.policy = p
+	wp.Unlock()
+
+	wp.notifyResize()
+}
+
+func (wp *Pool[T, R]) getMaxIdleWorkerDuration() time.Duration {
+	wp.Lock()
+	d := wp.maxIdleWorkerDuration
+	wp.Unlock()
+	return d
+}
+
+// notifyResize wakes up the reaper without blocking.
+func (wp *Pool[T, R]) notifyResize() {
+	select {
+	case wp.resizeCh <- struct{}{}:
+	default:
+	}
+}
+
+// reap stops the idle workers which are idle too long but keeps the warm workers of
+// scaling policy, then starts the missing warm workers.
+func (wp *Pool[T, R]) reap(idleWorkers []*worker[T, R]) []*worker[T, R] {
+	wp.Lock()
+	policy := wp.policy
+	wp.Unlock()
+
+	min := 0
+	if policy != nil {
+		min = policy.MinWorkers(wp.Stats())
+	}
+
+	currentTime := time.Now()
+
+	wp.Lock()
+	if min > wp.maxWorkersCount {
+		min = wp.maxWorkersCount
+	}
+
+	workers := wp.workers
+	n := len(workers)
+	i := 0
+
+	// Find the idle workers and cleanup
+	for i < n && wp.workersCount-i > min &&
+		currentTime.Sub(workers[i].lasted) > wp.maxIdleWorkerDuration {
+		i++
+	}
+
+	// nolint
+	idleWorkers = append(idleWorkers[:0], workers[:i]...)
+	if i > 0 {
+		m := copy(workers, workers[i:])
+		for i = m; i < n; i++ {
+			workers[i] = nil
+		}
+		wp.workers = workers[:m]
+	}
+
+	warm := 0
+	if !wp.stopped && wp.workersCount < min {
+		warm = min - wp.workersCount
+		wp.workersCount += warm
+	}
+	wp.Unlock()
+
+	atomic.AddUint64(&wp.numReaped, uint64(len(idleWorkers)))
+	for i := range idleWorkers {
+		worker := idleWorkers[i]
+		worker.ch <- job[T, R]{exit: true}
+		idleWorkers[i] = nil
+	}
+
+	for i := 0; i < warm; i++ {
+		wp.warmUp(wp.spawnWorker())
+	}
+
+	return idleWorkers[:0]
+}
+
+// warmUp puts the new worker to idle or serves the queued job.
+func (wp *Pool[T, R]) warmUp(w *worker[T, R]) {
+	w.lasted = time.Now()
+
+	wp.Lock()
+	if v, ok := wp.queue.pop(); ok {
+		wp.signal()
+		wp.Unlock()
+		w.ch <- v
+		return
+	}
+	if wp.stopped {
+		wp.Unlock()
+		w.ch <- job[T, R]{exit: true}
+		return
+	}
+	wp.workers = append(wp.workers, w)
+	wp.signal()
+	wp.Unlock()
+}
@@ -0,0 +1,153 @@
+package workerpool
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPoolSetMaxWorkers(t *testing.T) {
+	var wg sync.WaitGroup
+	block := make(chan struct{})
+	handler := func(v interface{}) {
+		if v.(int) == 0 {
+			<-block
+		}
+		wg.Done()
+	}
+
+	wp, err := New(HandlerFunc(handler),
+		WithWorkerPoolMaxWorkersCount(1),
+		WithWorkerPoolQueueSize(4))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	wg.Add(4)
+	assert.True(t, wp.Serve(0))
+	for i := 1; i < 4; i++ {
+		assert.True(t, wp.Serve(i))
+	}
+	assert.Equal(t, 3, wp.QueueLen())
+
+	// the queued jobs are served by the new workers
+	wp.SetMaxWorkers(4)
+	assert.Eventually(t, func() bool {
+		s := wp.Stats()
+		return s.QueueLen == 0 && s.IdleWorkers == 3
+	}, time.Second, time.Millisecond)
+
+	// the excess idle workers are stopped
+	wp.SetMaxWorkers(1)
+	assert.Eventually(t, func() bool {
+		s := wp.Stats()
+		return s.Workers == 1 && s.BusyWorkers == 1
+	}, time.Second, time.Millisecond)
+	wg.Add(1)
+	assert.True(t, wp.Serve(1))
+	assert.Equal(t, 1, wp.QueueLen())
+	close(block)
+	wg.Wait()
+
+	// the busy workers beyond the max exit once served
+	block = make(chan struct{})
+	wp.SetMaxWorkers(2)
+	wg.Add(2)
+	assert.True(t, wp.Serve(0))
+	assert.True(t, wp.Serve(0))
+	wp.SetMaxWorkers(1)
+	close(block)
+	wg.Wait()
+	assert.Eventually(t, func() bool {
+		s := wp.Stats()
+		return s.Workers == 1 && s.IdleWorkers == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestWorkerPoolSetMaxWorkersShrinkBusy(t *testing.T) {
+	var wg sync.WaitGroup
+	blocks := []chan struct{}{make(chan struct{}), make(chan struct{})}
+	handler := func(v interface{}) {
+		<-blocks[v.(int)]
+		wg.Done()
+	}
+
+	wp, err := New(HandlerFunc(handler), WithWorkerPoolMaxWorkersCount(4))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	// 2 busy workers and 2 idle workers
+	wg.Add(4)
+	for i := 0; i < 4; i++ {
+		assert.True(t, wp.Serve(i%2))
+	}
+	close(blocks[1])
+	assert.Eventually(t, func() bool {
+		s := wp.Stats()
+		return s.Workers == 4 && s.IdleWorkers == 2
+	}, time.Second, time.Millisecond)
+
+	// the idle workers are uncounted at once thus the busy ones are kept
+	wp.SetMaxWorkers(2)
+	s := wp.Stats()
+	assert.Equal(t, 2, s.Workers)
+	assert.Equal(t, 0, s.IdleWorkers)
+
+	close(blocks[0])
+	wg.Wait()
+	assert.Eventually(t, func() bool {
+		s := wp.Stats()
+		return s.Workers == 2 && s.IdleWorkers == 2
+	}, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 2, wp.Stats().Workers)
+}
+
+func TestWorkerPoolScalingPolicy(t *testing.T) {
+	wp, err := New(HandlerFunc(func(v interface{}) {}),
+		WithWorkerPoolMaxWorkersCount(8),
+		WithWorkerPoolMaxIdleWorkerDuration(time.Millisecond),
+		WithWorkerPoolScalingPolicy(MinWorkersPolicy(3)))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	// the warm workers are started ahead of the jobs
+	wp.Start()
+	assert.Eventually(t, func() bool {
+		return wp.Stats().IdleWorkers == 3
+	}, time.Second, time.Millisecond)
+
+	// the idle workers beyond the warm workers are reaped
+	for i := 0; i < 8; i++ {
+		assert.True(t, wp.Serve(i))
+	}
+	assert.Eventually(t, func() bool {
+		s := wp.Stats()
+		return s.Reaped > 0 && s.Workers == 3
+	}, time.Second, time.Millisecond)
+
+	wp.SetScalingPolicy(nil)
+	assert.Eventually(t, func() bool {
+		return wp.Stats().Workers == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestWorkerPoolSetMaxIdleWorkerDuration(t *testing.T) {
+	wp, err := New(HandlerFunc(func(v interface{}) {}),
+		WithWorkerPoolMaxIdleWorkerDuration(time.Hour))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	wp.Start()
+	assert.True(t, wp.Serve(1))
+	assert.Eventually(t, func() bool {
+		return wp.Stats().IdleWorkers == 1
+	}, time.Second, time.Millisecond)
+
+	// the reaper reacts to the resize immediately
+	wp.SetMaxIdleWorkerDuration(time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return wp.Stats().Reaped == 1
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,69 @@
+package workerpool
+
+import (
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Stats is the snapshot of the statistics of worker pool.
+type Stats struct {
+	// Workers is the number of current workers
+	Workers int `json:"workers"`
+	// IdleWorkers is the number of workers waiting for job
+	IdleWorkers int `json:"idle_workers"`
+	// BusyWorkers is the number of workers serving job
+	BusyWorkers int `json:"busy_workers"`
+	// MaxWorkers is the max number of workers
+	MaxWorkers int `json:"max_workers"`
+	// QueueLen is the number of queued jobs
+	QueueLen int `json:"queue_len"`
+	// QueueSize is the capacity of job queue
+	QueueSize int `json:"queue_size"`
+	// Served is the number of served jobs
+	Served uint64 `json:"served"`
+	// Rejected is the number of jobs which cannot be served
+	Rejected uint64 `json:"rejected"`
+	// Panics is the number of jobs which panicked
+	Panics uint64 `json:"panics"`
+	// Errors is the number of jobs which failed
+	Errors uint64 `json:"errors"`
+	// Reaped is the number of idle workers stopped by the reaper
+	Reaped uint64 `json:"reaped"`
+	// MeanJobDuration is the mean duration of served jobs
+	MeanJobDuration time.Duration `json:"mean_job_duration_ns"`
+	// Stopped indicates whether the worker pool was stopped
+	Stopped bool `json:"stopped"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *Stats) MarshalJSON() ([]byte, error) {
+	type stats Stats
+	return jsoniter.Marshal((*stats)(s))
+}
+
+// Stats returns the snapshot of the statistics.
+func (wp *Pool[T, R]) Stats() Stats {
+	wp.Lock()
+	s := Stats{
+		Workers:     wp.workersCount,
+		IdleWorkers: len(wp.workers),
+		MaxWorkers:  wp.maxWorkersCount,
+		QueueLen:    wp.queue.n,
+		QueueSize:   wp.queue.size,
+		Stopped:     wp.stopped,
+	}
+	wp.Unlock()
+
+	s.BusyWorkers = s.Workers - s.IdleWorkers
+	s.Served = atomic.LoadUint64(&wp.numServed)
+	s.Rejected = atomic.LoadUint64(&wp.numRejected)
+	s.Panics = atomic.LoadUint64(&wp.numPanics)
+	s.Errors = atomic.LoadUint64(&wp.numErrors)
+	s.Reaped = atomic.LoadUint64(&wp.numReaped)
+	if s.Served > 0 {
+		s.MeanJobDuration = time.Duration(atomic.LoadUint64(&wp.jobDuration) / s.Served)
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package workerpool
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPoolStats(t *testing.T) {
+	var wg sync.WaitGroup
+	block := make(chan struct{})
+	handler := func(v interface{}) {
+		if v.(int) == 0 {
+			<-block
+		}
+		time.Sleep(time.Millisecond)
+		wg.Done()
+	}
+
+	wp, err := New(HandlerFunc(handler),
+		WithWorkerPoolMaxWorkersCount(2),
+		WithWorkerPoolQueueSize(1),
+		WithWorkerPoolMaxIdleWorkerDuration(10*time.Millisecond))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	wg.Add(3)
+	assert.True(t, wp.Serve(0))
+	assert.True(t, wp.Serve(0))
+	assert.True(t, wp.Serve(1))
+	assert.False(t, wp.Serve(1))
+
+	s := wp.Stats()
+	assert.Equal(t, 2, s.Workers)
+	assert.Equal(t, 2, s.BusyWorkers)
+	assert.Equal(t, 0, s.IdleWorkers)
+	assert.Equal(t, 2, s.MaxWorkers)
+	assert.Equal(t, 1, s.QueueLen)
+	assert.Equal(t, uint64(1), s.Rejected)
+
+	close(block)
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		return wp.Stats().IdleWorkers == 2
+	}, time.Second, time.Millisecond)
+	s = wp.Stats()
+	assert.Equal(t, uint64(3), s.Served)
+	assert.Equal(t, 0, s.BusyWorkers)
+	assert.GreaterOrEqual(t, int64(s.MeanJobDuration), int64(time.Millisecond))
+
+	// the idle workers are reaped
+	wp.Start()
+	assert.Eventually(t, func() bool {
+		return wp.Stats().Reaped == 2
+	}, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return wp.Stats().Workers == 0
+	}, time.Second, time.Millisecond)
+
+	s = wp.Stats()
+	js, err := s.MarshalJSON()
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(js), `{"workers":0,"idle_workers":0,"busy_workers":0,"max_workers":2,`))
+	assert.Contains(t, string(js), `"served":3,"rejected":1,`)
+	assert.Contains(t, string(js), `"reaped":2,`)
+}
@@ -1,9 +1,12 @@
 package workerpool
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -31,3 +34,237 @@ func TestWorkerPool(t *testing.T) {
 	wg.Wait()
 	assert.Equal(t, sum, uint64(1000*999/2))
 }
+
+func TestWorkerPoolPriorityQueue(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	block := make(chan struct{})
+	handler := func(v interface{}) {
+		if v.(string) == "A" {
+			<-block
+		}
+		mu.Lock()
+		order = append(order, v.(string))
+		mu.Unlock()
+		wg.Done()
+	}
+
+	wp, err := New(HandlerFunc(handler),
+		WithWorkerPoolMaxWorkersCount(1),
+		WithWorkerPoolQueueSize(3))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	wg.Add(4)
+	assert.True(t, wp.Serve("A"))
+	assert.True(t, wp.ServePriority(PriorityLow, "L"))
+	assert.True(t, wp.Serve("N"))
+	assert.True(t, wp.ServePriority(PriorityHigh, "H"))
+	assert.Equal(t, 3, wp.QueueLen())
+
+	// the queue is full
+	assert.False(t, wp.Serve("X"))
+
+	close(block)
+	wg.Wait()
+	assert.Equal(t, []string{"A", "H", "N", "L"}, order)
+	assert.Equal(t, 0, wp.QueueLen())
+}
+
+func TestWorkerPoolServeContext(t *testing.T) {
+	var wg sync.WaitGroup
+	block := make(chan struct{})
+	handler := func(v interface{}) {
+		<-block
+		wg.Done()
+	}
+
+	wp, err := New(HandlerFunc(handler), WithWorkerPoolMaxWorkersCount(1))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	wg.Add(1)
+	assert.True(t, wp.Serve(1))
+	assert.False(t, wp.Serve(2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, wp.ServeContext(ctx, 2))
+	assert.Equal(t, ErrServeTimeout, wp.ServeTimeout(2, 10*time.Millisecond))
+
+	// the blocked serve returns once the worker is free
+	wg.Add(1)
+	done := make(chan error)
+	go func() {
+		done <- wp.ServeContext(context.Background(), 3)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(block)
+	assert.Nil(t, <-done)
+	wg.Wait()
+}
+
+func TestWorkerPoolPanicRecovery(t *testing.T) {
+	var (
+		wg     sync.WaitGroup
+		sum    uint64
+		panics uint64
+	)
+	handler := func(v interface{}) {
+		defer wg.Done()
+		if v.(uint64)%2 == 0 {
+			panic("boom")
+		}
+		atomic.AddUint64(&sum, v.(uint64))
+	}
+
+	wp, err := New(HandlerFunc(handler),
+		WithWorkerPoolMaxWorkersCount(2),
+		WithWorkerPoolQueueSize(100),
+		WithWorkerPoolPanicHandler(func(v interface{}, r interface{}) {
+			assert.Equal(t, "boom", r)
+			atomic.AddUint64(&panics, 1)
+		}))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		assert.True(t, wp.Serve(uint64(i)))
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(50*50), atomic.LoadUint64(&sum))
+	assert.Equal(t, uint64(50), atomic.LoadUint64(&panics))
+	assert.Equal(t, uint64(50), wp.GetPanics())
+
+	// the workers survived
+	wp.Lock()
+	assert.LessOrEqual(t, wp.workersCount, 2)
+	wp.Unlock()
+	wg.Add(1)
+	assert.Nil(t, wp.ServeTimeout(uint64(1), time.Second))
+	wg.Wait()
+}
+
+func TestWorkerPoolHandlerFuncE(t *testing.T) {
+	var wg sync.WaitGroup
+	errFailed := errors.New("failed")
+	handler := func(v interface{}) error {
+		if v.(int) < 0 {
+			return errFailed
+		}
+		wg.Done()
+		return nil
+	}
+
+	var failed []interface{}
+	wp, err := New(HandlerFuncE(handler),
+		WithWorkerPoolMaxWorkersCount(1),
+		WithWorkerPoolQueueSize(10),
+		WithWorkerPoolErrorHandler(func(v interface{}, err error) {
+			assert.Equal(t, errFailed, err)
+			failed = append(failed, v)
+			wg.Done()
+		}))
+	assert.Nil(t, err)
+	defer wp.Stop()
+
+	for _, v := range []int{1, -1, 2, -2} {
+		wg.Add(1)
+		assert.True(t, wp.Serve(v))
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(2), wp.GetErrors())
+	assert.Equal(t, []interface{}{-1, -2}, failed)
+}
+
+func TestWorkerPoolStop(t *testing.T) {
+	var wg sync.WaitGroup
+	wp, err := New(HandlerFunc(func(v interface{}) { wg.Done() }))
+	assert.Nil(t, err)
+
+	wp.Start()
+	wp.Start()
+	wg.Add(1)
+	assert.True(t, wp.Serve(1))
+	wg.Wait()
+
+	wp.Stop()
+	wp.Stop()
+	assert.True(t, wp.IsStopped())
+	assert.False(t, wp.Serve(2))
+	assert.Equal(t, ErrStopped, wp.ServeContext(context.Background(), 2))
+
+	// restart the stopped worker pool
+	wp.Start()
+	assert.False(t, wp.IsStopped())
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		assert.Nil(t, wp.ServeTimeout(i, time.Second))
+	}
+	wg.Wait()
+	assert.Nil(t, wp.Shutdown(context.Background()))
+}
+
+func TestWorkerPoolShutdown(t *testing.T) {
+	var served uint64
+	block := make(chan struct{})
+	handler := func(v interface{}) {
+		<-block
+		atomic.AddUint64(&served, 1)
+	}
+
+	wp, err := New(HandlerFunc(handler),
+		WithWorkerPoolMaxWorkersCount(2),
+		WithWorkerPoolQueueSize(8))
+	assert.Nil(t, err)
+	wp.Start()
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, wp.Serve(i))
+	}
+
+	// the in-flight jobs are not served before timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, wp.Shutdown(ctx))
+	assert.False(t, wp.Serve(10))
+
+	close(block)
+	assert.Nil(t, wp.Shutdown(context.Background()))
+	assert.Equal(t, uint64(10), atomic.LoadUint64(&served))
+
+	wp.Lock()
+	assert.Equal(t, 0, wp.workersCount)
+	wp.Unlock()
+	wp.Stop()
+}
+
+func TestWorkerPoolStopDropsQueue(t *testing.T) {
+	var served uint64
+	block := make(chan struct{})
+	handler := func(v interface{}) {
+		<-block
+		atomic.AddUint64(&served, 1)
+	}
+
+	wp, err := New(HandlerFunc(handler),
+		WithWorkerPoolMaxWorkersCount(1),
+		WithWorkerPoolQueueSize(8))
+	assert.Nil(t, err)
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, wp.Serve(i))
+	}
+	wp.Stop()
+	assert.Equal(t, 0, wp.QueueLen())
+
+	close(block)
+	assert.Nil(t, wp.Shutdown(context.Background()))
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&served))
+}
@@ -12,16 +12,16 @@
 //
 
 // Package AsyncWriter implements the io.Writer which batch writes (maybe writev if it's net.Conn) to writer by channel
+// or the sharded lock-free queue.
+//
+// It's a compatibility shim over the pipeline package, the new code should use pipeline directly.
 package asyncwriter
 
 import (
 	"errors"
 	"io"
-	"runtime"
-	"sync/atomic"
-	"time"
 
-	uatomic "go.uber.org/atomic"
+	"github.com/sofastack/sofa-common-go/writer/pipeline"
 )
 
 var (
@@ -39,9 +39,7 @@ type AsyncWriter struct {
 	option           *Option
 	writer           io.Writer
 	metrics          *Metrics
-	buffers          chan *[]byte
-	closed           uint32
-	werr             uatomic.Error
+	pipeline         *pipeline.Pipeline
 	disableAutoStart bool
 }
 
@@ -76,12 +74,35 @@ func (aw *AsyncWriter) polyfill() error {
 		aw.metrics = NewMetrics()
 	}
 
-	if aw.option.batch == 0 {
-		aw.buffers = make(chan *[]byte, 256*runtime.NumCPU())
-	} else {
-		aw.buffers = make(chan *[]byte, aw.option.batch)
+	o := pipeline.NewOption().
+		SetMode(pipeline.ManualMode).
+		SetQueueMode(aw.option.queueMode).
+		SetShards(aw.option.shards).
+		SetCapacity(aw.option.batch).
+		SetTimeout(aw.option.timeout).
+		SetFlushInterval(aw.option.flushInterval).
+		EnableCloseWriter().
+		SetMetrics(metricsAdapter{aw.metrics}).
+		SetErrors(pipeline.Errors{
+			Closed:       ErrAsyncWriterClosed,
+			TooManyWrite: ErrAsyncWriterTooManyWrite,
+		})
+	if aw.option.blockwrite {
+		o.AllowBlockForever()
+	}
+	if aw.option.adaptive != nil {
+		o.SetAdaptiveFlush(*aw.option.adaptive)
+	}
+	if aw.option.histograms {
+		o.EnableHistograms()
 	}
 
+	p, err := pipeline.New(aw.writer, o)
+	if err != nil {
+		return errors.New("asyncwriter: unknown queue mode")
+	}
+	aw.pipeline = p
+
 	return nil
 }
 
@@ -89,139 +110,34 @@ func (bw *AsyncWriter) GetMetrics() *Metrics {
 	return bw.metrics
 }
 
+// GetHistograms returns the histograms, it's nil unless the histograms are enabled.
+func (bw *AsyncWriter) GetHistograms() *pipeline.Histograms {
+	return bw.pipeline.GetHistograms()
+}
+
 func (bw *AsyncWriter) IsClosed() bool {
-	return atomic.LoadUint32(&bw.closed) == 1
+	return bw.pipeline.IsClosed()
 }
 
 func (bw *AsyncWriter) Close() error {
-	if !atomic.CompareAndSwapUint32(&bw.closed, 0, 1) {
-		return ErrAsyncWriterClosed
-	}
-
-	// try to nil to channel indicates close
-	bw.buffers <- nil
-
-	if cw, ok := bw.writer.(io.WriteCloser); ok {
-		return cw.Close()
-	}
-
-	return nil
+	return bw.pipeline.Close()
 }
 
 func (bw *AsyncWriter) Write(d []byte) (int, error) {
-	if len(d) == 0 { // avoid send nil buffer
-		return 0, nil
-	}
-
-	if err := bw.werr.Load(); err != nil {
-		return 0, err
-	}
-
-	if bw.IsClosed() {
-		return 0, ErrAsyncWriterClosed
-	}
-
-	if !bw.option.blockwrite {
-		if len(bw.buffers) >= cap(bw.buffers) {
-			return 0, ErrAsyncWriterTooManyWrite
-		}
-	}
-
-	bw.metrics.AddCommands()
-	bw.metrics.AddPendingCommands(1)
-
-	b := acquireBuffer()
-	*b = append((*b)[:0], d...)
-	nd := len(d)
-	bw.buffers <- b
+	return bw.pipeline.Write(d)
+}
 
-	return nd, nil
+// WriteOwned writes the buffer acquired from bytespool.AcquireBytes without copying.
+// The ownership of b is transferred to the writer which releases it to bytespool
+// once written or failed, thus the caller must not touch b after calling.
+func (bw *AsyncWriter) WriteOwned(b *[]byte) (int, error) {
+	return bw.pipeline.WriteOwned(b)
 }
 
+// DoWrite runs the write loop until closed or failed to write.
 func (bw *AsyncWriter) DoWrite() error {
-	ctx := acquireContext(bw.option, bw.writer)
-
-	var (
-		d               *[]byte
-		n               int
-		err             error
-		flushTimer      = getFlushTimer()
-		flushCh         <-chan time.Time
-		flushAlwaysCh   = make(chan time.Time)
-		pendingrequests int64
-	)
-
-	close(flushAlwaysCh)
-
-SENDLOOP:
-	for {
-		select {
-		case d = <-bw.buffers:
-		default:
-			// slow path
-			select {
-			case <-flushCh:
-				n, err = ctx.Flush()
-				bw.metrics.AddPendingCommands(-pendingrequests)
-				bw.metrics.AddBytes(int64(n))
-				pendingrequests = 0
-
-				if err != nil {
-					break SENDLOOP
-				}
-
-				flushCh = nil
-				continue
-
-			case d = <-bw.buffers:
-			}
-		}
-
-		if d == nil || len(*d) == 0 {
-			// try flush the pending buffer
-			// nolint
-			n, _ = ctx.Flush()
-			bw.metrics.AddPendingCommands(-pendingrequests)
-			bw.metrics.AddBytes(int64(n))
-
-			err = ErrAsyncWriterClosed
-			break SENDLOOP
-		}
-
-		ctx.buffer = append(ctx.buffer, *d...)
-		releaseBuffer(d)
-		pendingrequests++
-
-		if flushCh == nil {
-			if bw.option.flushInterval > 0 {
-				resetFlushTimer(flushTimer, bw.option.flushInterval)
-				flushCh = flushTimer.C
-			} else {
-				flushCh = flushAlwaysCh
-			}
-		}
-	}
-
-	putFlushTimer(flushTimer)
-	releaseContext(ctx)
-
-	// store the write error and set the closed status
-	bw.werr.Store(err)
-	atomic.StoreUint32(&bw.closed, 1)
-
-	// cleanup pending buffers
-	for len(bw.buffers) > 0 {
-		select {
-		case d := <-bw.buffers:
-			if d != nil {
-				releaseBuffer(d)
-			}
-		default:
-		}
+	if bw.option.writev {
+		return bw.pipeline.RunMode(pipeline.WritevMode)
 	}
-
-	// cleanup the pending commands metrics
-	bw.metrics.AddPendingCommands(-bw.metrics.GetPendingCommands())
-
-	return err
+	return bw.pipeline.RunMode(pipeline.FlushMode)
 }
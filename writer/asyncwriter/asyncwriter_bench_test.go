@@ -14,11 +14,13 @@
 package asyncwriter
 
 import (
+	"fmt"
 	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/sofastack/sofa-common-go/syncpool/bytespool"
 	"github.com/stretchr/testify/require"
 )
 
@@ -127,3 +129,100 @@ func BenchmarkBatchWriteParallel(b *testing.B) {
 	b.ReportMetric(float64(success), "success")
 	b.ReportMetric(float64(failure), "failure")
 }
+
+func BenchmarkQueueWriteParallel(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		mode QueueMode
+	}{
+		{"channel", ChannelQueue},
+		{"sharded", ShardedQueue},
+	} {
+		for _, delay := range []time.Duration{0, 10 * time.Millisecond} {
+			b.Run(fmt.Sprintf("%s/delay=%s", bc.name, delay), func(b *testing.B) {
+				benchmarkQueueWriteParallel(b, bc.mode, delay)
+			})
+		}
+	}
+}
+
+func benchmarkQueueWriteParallel(b *testing.B, mode QueueMode, delay time.Duration) {
+	mw := &reusebuffer{}
+
+	bw, err := New(mw, WithAsyncWriterOption(NewOption().
+		AllowBlockForever().
+		SetQueueMode(mode).
+		SetBatch(1024).
+		SetFlushInterval(delay)),
+	)
+	require.Nil(b, err)
+	defer bw.Close()
+
+	success := int64(0)
+	failure := int64(0)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(x)))
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, err := bw.Write(x)
+			if err != nil {
+				atomic.AddInt64(&failure, 1)
+				continue
+			}
+			atomic.AddInt64(&success, 1)
+		}
+	})
+
+	b.ReportMetric(float64(success), "success")
+	b.ReportMetric(float64(failure), "failure")
+}
+
+var large = []byte(strings.Repeat("0123456789", 1024))
+
+func BenchmarkLargeWrite(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		owned  bool
+		writev bool
+	}{
+		{"copy", false, false},
+		{"copy-writev", false, true},
+		{"owned", true, false},
+		{"owned-writev", true, true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			option := NewOption().AllowBlockForever().SetBatch(1024)
+			if bc.writev {
+				option.EnableWritev()
+			}
+			bw, err := New(&reusebuffer{}, WithAsyncWriterOption(option))
+			require.Nil(b, err)
+			defer bw.Close()
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(large)))
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				var err error
+				for pb.Next() {
+					if bc.owned {
+						// the record is encoded into the owned buffer directly
+						p := bytespool.AcquireBytes()
+						*p = append(*p, large...)
+						_, err = bw.WriteOwned(p)
+					} else {
+						_, err = bw.Write(large)
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
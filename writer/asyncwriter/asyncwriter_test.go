@@ -17,12 +17,15 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"io/ioutil"
+	"net"
 	"runtime"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/sofastack/sofa-common-go/syncpool/bytespool"
 	"github.com/stretchr/testify/require"
 	uatomic "go.uber.org/atomic"
 )
@@ -127,3 +130,159 @@ func TestAsyncWriterPendingMetrics(t *testing.T) {
 		time.Sleep(500 * time.Millisecond)
 	}
 }
+
+func TestAsyncWriterShardedQueue(t *testing.T) {
+	mw := &Buffer{}
+
+	bw, err := New(mw, WithAsyncWriterOption(NewOption().
+		SetQueueMode(ShardedQueue).
+		SetShards(4).
+		SetBatch(64).
+		AllowBlockForever()))
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(8)
+	for i := 0; i < 8; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := bw.Write([]byte("0123456789"))
+				require.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Eventually(t, func() bool {
+		return bw.GetMetrics().GetBytes() == 8*100*10
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, strings.Repeat("0123456789", 800), mw.String())
+	require.Equal(t, int64(800), bw.GetMetrics().GetCommands())
+	require.Equal(t, int64(0), bw.GetMetrics().GetPendingCommands())
+
+	mw.SetWriteError(io.EOF)
+	_, err = bw.Write([]byte("abcd"))
+	require.Nil(t, err)
+	require.Eventually(t, bw.IsClosed, time.Second, 10*time.Millisecond)
+	_, err = bw.Write([]byte("abcd"))
+	require.Equal(t, io.EOF, err)
+}
+
+func TestAsyncWriterShardedQueueClose(t *testing.T) {
+	mw := &Buffer{}
+
+	bw, err := New(mw, WithAsyncWriterOption(NewOption().
+		SetQueueMode(ShardedQueue).
+		SetFlushInterval(time.Hour)))
+	require.Nil(t, err)
+
+	_, err = bw.Write([]byte("abcd"))
+	require.Nil(t, err)
+	require.Nil(t, bw.Close())
+
+	// the pending buffer is flushed once closed
+	require.Eventually(t, func() bool {
+		return mw.String() == "abcd"
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = bw.Write([]byte("abcd"))
+	require.Equal(t, ErrAsyncWriterClosed, err)
+}
+
+func TestAsyncWriterShardedQueueTooManyWrite(t *testing.T) {
+	bw, err := New(&Buffer{}, WithAsyncWriterOption(NewOption().
+		SetQueueMode(ShardedQueue).
+		SetShards(1).
+		SetBatch(2)), AsyncWriterOptionSetterFunc(func(c *AsyncWriter) {
+		c.disableAutoStart = true
+	}))
+	require.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = bw.Write([]byte("abcd"))
+		require.Nil(t, err)
+	}
+	_, err = bw.Write([]byte("abcd"))
+	require.Equal(t, ErrAsyncWriterTooManyWrite, err)
+	require.Equal(t, int64(2), bw.GetMetrics().GetPendingCommands())
+}
+
+func TestAsyncWriterWriteOwned(t *testing.T) {
+	for _, option := range []*Option{
+		NewOption().AllowBlockForever(),
+		NewOption().AllowBlockForever().EnableWritev(),
+		NewOption().AllowBlockForever().EnableWritev().SetQueueMode(ShardedQueue),
+	} {
+		mw := &Buffer{}
+		bw, err := New(mw, WithAsyncWriterOption(option))
+		require.Nil(t, err)
+
+		for i := 0; i < 32; i++ {
+			b := bytespool.AcquireBytes()
+			*b = append(*b, "0123456789"...)
+			n, err := bw.WriteOwned(b)
+			require.Nil(t, err)
+			require.Equal(t, 10, n)
+		}
+
+		n, err := bw.WriteOwned(bytespool.AcquireBytes())
+		require.Nil(t, err)
+		require.Equal(t, 0, n)
+
+		require.Eventually(t, func() bool {
+			return bw.GetMetrics().GetBytes() == 10*32
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, strings.Repeat("0123456789", 32), mw.String())
+		require.Equal(t, int64(0), bw.GetMetrics().GetPendingCommands())
+
+		require.Nil(t, bw.Close())
+		b := bytespool.AcquireBytes()
+		*b = append(*b, "abcd"...)
+		_, err = bw.WriteOwned(b)
+		require.Equal(t, ErrAsyncWriterClosed, err)
+	}
+}
+
+func TestAsyncWriterWritevConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		received <- b
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.Nil(t, err)
+
+	bw, err := New(conn, WithAsyncWriterOption(NewOption().
+		AllowBlockForever().
+		EnableWritev().
+		SetTimeout(time.Second).
+		SetFlushInterval(10*time.Millisecond)))
+	require.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		_, err = bw.Write([]byte("0123456789"))
+		require.Nil(t, err)
+	}
+	require.Eventually(t, func() bool {
+		return bw.GetMetrics().GetBytes() == 1000
+	}, time.Second, 10*time.Millisecond)
+	require.Nil(t, bw.Close())
+
+	select {
+	case b := <-received:
+		require.Equal(t, strings.Repeat("0123456789", 100), string(b))
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
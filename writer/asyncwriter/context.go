@@ -1,60 +0,0 @@
-// nolint
-// Copyright 20xx The Alipay Authors.
-//
-// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
-// @authors[1]: robotx(robotx@antfin.com)
-//
-// *Legal Disclaimer*
-// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
-// *法律免责声明*
-// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
-//
-//
-
-package asyncwriter
-
-import (
-	"io"
-	"net"
-	"time"
-)
-
-type context struct {
-	option     *Option
-	writer     io.Writer
-	buffer     []byte
-	buffers    [][]byte
-	buffersp   []*[]byte
-	conn       net.Conn
-	netbuffers net.Buffers
-}
-
-func (ctx *context) reset() {
-	ctx.option = nil
-	ctx.writer = nil
-	ctx.buffer = ctx.buffer[:0]
-	ctx.buffers = ctx.buffers[:0]
-	ctx.buffersp = ctx.buffersp[:0]
-	ctx.conn = nil
-	ctx.netbuffers = ctx.netbuffers[:0]
-}
-
-func (ctx *context) Flush() (int, error) {
-	if len(ctx.buffer) > 0 {
-		if ctx.option.timeout != 0 {
-			if ctx.conn != nil { // can set timeout
-				if err := ctx.conn.SetWriteDeadline(time.Now().Add(ctx.option.timeout)); err != nil {
-					return 0, err
-				}
-			}
-		}
-
-		n, err := ctx.writer.Write(ctx.buffer)
-		if err != nil {
-			return 0, err
-		}
-		ctx.buffer = ctx.buffer[:0]
-		return n, nil
-	}
-	return 0, nil
-}
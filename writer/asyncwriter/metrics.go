@@ -13,12 +13,17 @@
 
 package asyncwriter
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 type Metrics struct {
 	commands        *int64
 	pendingCommands *int64
 	bytes           *int64
+	flushDelay      int64
+	batchSize       int64
 }
 
 func NewMetrics() *Metrics {
@@ -50,3 +55,28 @@ func (m *Metrics) GetBytes() int64 { return atomic.LoadInt64(m.bytes) }
 func (m *Metrics) SetBytes(i *int64) {
 	m.bytes = i
 }
+
+// GetFlushDelay returns the flush delay chosen by the adaptive flush.
+func (m *Metrics) GetFlushDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.flushDelay))
+}
+
+// GetBatchSize returns the batch size chosen by the adaptive flush.
+func (m *Metrics) GetBatchSize() int64 { return atomic.LoadInt64(&m.batchSize) }
+
+// metricsAdapter adapts Metrics to pipeline.Metrics.
+type metricsAdapter struct {
+	m *Metrics
+}
+
+func (a metricsAdapter) AddRequests(n int64) { atomic.AddInt64(a.m.commands, n) }
+
+func (a metricsAdapter) AddPendingRequests(n int64) { a.m.AddPendingCommands(n) }
+
+func (a metricsAdapter) GetPendingRequests() int64 { return a.m.GetPendingCommands() }
+
+func (a metricsAdapter) AddBytes(n int64) { a.m.AddBytes(n) }
+
+func (a metricsAdapter) SetFlushDelay(d time.Duration) { atomic.StoreInt64(&a.m.flushDelay, int64(d)) }
+
+func (a metricsAdapter) SetBatchSize(n int64) { atomic.StoreInt64(&a.m.batchSize, n) }
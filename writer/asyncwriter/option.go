@@ -15,6 +15,18 @@ package asyncwriter
 
 import (
 	"time"
+
+	"github.com/sofastack/sofa-common-go/writer/pipeline"
+)
+
+// QueueMode is the queue between the writers and the DoWrite loop.
+type QueueMode = pipeline.QueueMode
+
+const (
+	// ChannelQueue funnels the writes through one buffered channel.
+	ChannelQueue = pipeline.ChannelQueue
+	// ShardedQueue spreads the writes over lock-free ring buffers, see pipeline.ShardedQueue.
+	ShardedQueue = pipeline.ShardedQueue
 )
 
 type AsyncWriterOptionSetter interface {
@@ -43,8 +55,13 @@ func WithAsyncWriterMetrics(m *Metrics) AsyncWriterOptionSetterFunc {
 type Option struct {
 	timeout       time.Duration
 	flushInterval time.Duration
+	adaptive      *pipeline.AdaptiveFlush
+	histograms    bool
 	batch         int
 	blockwrite    bool
+	queueMode     QueueMode
+	shards        int
+	writev        bool
 }
 
 // NewOption returns a new Option.
@@ -55,6 +72,26 @@ func (o *Option) SetFlushInterval(d time.Duration) *Option {
 	return o
 }
 
+// SetAdaptiveFlush tunes the flush delay and batch size within the bounds from the observed
+// arrival rate and write latency, it overrides the flush interval. The chosen values are
+// exposed by Metrics.GetFlushDelay and Metrics.GetBatchSize.
+func (o *Option) SetAdaptiveFlush(minDelay, maxDelay time.Duration, minBatch, maxBatch int) *Option {
+	o.adaptive = &pipeline.AdaptiveFlush{
+		MinDelay: minDelay,
+		MaxDelay: maxDelay,
+		MinBatch: minBatch,
+		MaxBatch: maxBatch,
+	}
+	return o
+}
+
+// EnableHistograms records the histograms of queue latency, write duration and records
+// per flush, see AsyncWriter.GetHistograms.
+func (o *Option) EnableHistograms() *Option {
+	o.histograms = true
+	return o
+}
+
 // SetTimeout sets the timeout for write if it's net.Conn
 func (o *Option) SetTimeout(d time.Duration) *Option {
 	o.timeout = d
@@ -71,3 +108,22 @@ func (o *Option) SetBatch(b int) *Option {
 	o.batch = b
 	return o
 }
+
+// SetQueueMode sets the queue between the writers and the DoWrite loop, default to ChannelQueue.
+func (o *Option) SetQueueMode(m QueueMode) *Option {
+	o.queueMode = m
+	return o
+}
+
+// SetShards sets the number of shards of ShardedQueue, default to GOMAXPROCS.
+func (o *Option) SetShards(n int) *Option {
+	o.shards = n
+	return o
+}
+
+// EnableWritev writes the buffers by writev (net.Buffers) without copying them into
+// one buffer, it saves the copy of large records especially for WriteOwned.
+func (o *Option) EnableWritev() *Option {
+	o.writev = true
+	return o
+}
@@ -1,17 +1,17 @@
 // Package batchwriter implements the io.Writer which batch writes (maybe writev if it's net.Conn) to writer by channel
+//
+// It's a compatibility shim over the pipeline package, the new code should use pipeline directly.
 package batchwriter
 
 import (
 	"errors"
 	"io"
-	"net"
 	"runtime"
 	"sync/atomic"
 	"time"
 
 	workerpool "github.com/sofastack/sofa-common-go/syncpool/fast-workerpool"
-	"github.com/sofastack/sofa-common-go/syncpool/fastbuffer"
-	uatomic "go.uber.org/atomic"
+	"github.com/sofastack/sofa-common-go/writer/pipeline"
 )
 
 var (
@@ -24,6 +24,9 @@ var (
 
 	// ErrBatchWriterAtivelyClose indicates caller actively close the writer.
 	ErrBatchWriterAtivelyClose = errors.New("batchwriter: writer close actively")
+
+	// ErrBatchWriterPoolStopped indicates the workerpool serving the writer was stopped.
+	ErrBatchWriterPoolStopped = errors.New("batchwriter: workerpool was stopped")
 )
 
 type WriteMode uint8
@@ -43,6 +46,10 @@ type Option struct {
 	timeout         time.Duration
 	maxinflights    int
 	maxFlushDelay   time.Duration
+	adaptive        *pipeline.AdaptiveFlush
+	histograms      bool
+	flushdelay      int64
+	batchsize       int64
 	blockwrite      bool
 	workerPool      *workerpool.WorkerPool
 }
@@ -56,12 +63,33 @@ func (o *Option) SetWriteMode(m WriteMode) *Option {
 	return o
 }
 
-// SetMaxFlushDelay sets the max delay of flush.
+// SetMaxFlushDelay sets the max delay of flush. It's ignored with the workerpool which
+// flushes the pending data once the writer was scheduled.
 func (o *Option) SetMaxFlushDelay(d time.Duration) *Option {
 	o.maxFlushDelay = d
 	return o
 }
 
+// SetAdaptiveFlush tunes the flush delay and batch size within the bounds from the observed
+// arrival rate and write latency, it overrides the max flush delay. The chosen values are
+// exposed by BatchWriter.GetFlushDelay and BatchWriter.GetBatchSize.
+func (o *Option) SetAdaptiveFlush(minDelay, maxDelay time.Duration, minBatch, maxBatch int) *Option {
+	o.adaptive = &pipeline.AdaptiveFlush{
+		MinDelay: minDelay,
+		MaxDelay: maxDelay,
+		MinBatch: minBatch,
+		MaxBatch: maxBatch,
+	}
+	return o
+}
+
+// EnableHistograms records the histograms of queue latency, write duration and records
+// per flush, see BatchWriter.GetHistograms.
+func (o *Option) EnableHistograms() *Option {
+	o.histograms = true
+	return o
+}
+
 // SetTimeout sets the timeout for write if it's net.Conn
 func (o *Option) SetTimeout(d time.Duration) *Option {
 	o.timeout = d
@@ -80,7 +108,10 @@ func (o *Option) SetMaxinflights(max int) *Option {
 	return o
 }
 
-// SetWorkerPool sets the workerpool to option.
+// SetWorkerPool sets the workerpool to option, the workerpool must be created by
+// workerpool.HandlerFunc(BatchWrite). The writer only holds a worker while it has pending
+// data thus one workerpool can be shared by many writers, see BatchWrite. The writer fails
+// with ErrBatchWriterPoolStopped once the workerpool was stopped.
 func (o *Option) SetWorkerPool(wp *workerpool.WorkerPool) *Option {
 	o.workerPool = wp
 	return o
@@ -104,16 +135,31 @@ func (o *Option) SetNumWrite(i64 *int64) *Option {
 	return o
 }
 
+// metrics adapts the metrics of option to pipeline.Metrics.
+type metrics struct {
+	o *Option
+}
+
+func (m metrics) AddRequests(n int64) { atomic.AddInt64(m.o.numrequests, n) }
+
+func (m metrics) AddPendingRequests(n int64) { atomic.AddInt64(m.o.pendingrequests, n) }
+
+func (m metrics) GetPendingRequests() int64 { return atomic.LoadInt64(m.o.pendingrequests) }
+
+func (m metrics) AddBytes(n int64) { atomic.AddInt64(m.o.numwrite, n) }
+
+func (m metrics) SetFlushDelay(d time.Duration) { atomic.StoreInt64(&m.o.flushdelay, int64(d)) }
+
+func (m metrics) SetBatchSize(n int64) { atomic.StoreInt64(&m.o.batchsize, n) }
+
 // BatchWriter wraps a writer and batch write it.
 //
 // nolint
 type BatchWriter struct {
 	o         *Option
 	w         io.Writer
-	b         fastbuffer.FastBuffer
-	inflights chan *[]byte
-	closed    uint32
-	werr      uatomic.Error
+	p         *pipeline.Pipeline
+	scheduled uint32
 }
 
 // NewBatchWriter returns a new batch writer.
@@ -123,27 +169,53 @@ func NewBatchWriter(o *Option, w io.Writer) (*BatchWriter, error) {
 	if o.maxinflights == 0 {
 		o.maxinflights = 2 * runtime.NumCPU()
 	}
-	bw := &BatchWriter{
-		w:         w,
-		o:         o,
-		inflights: make(chan *[]byte, o.maxinflights),
+
+	if o.numrequests == nil {
+		o.numrequests = new(int64)
 	}
 
-	if bw.o.numrequests == nil {
-		bw.o.numrequests = new(int64)
+	if o.pendingrequests == nil {
+		o.pendingrequests = new(int64)
 	}
 
-	if bw.o.pendingrequests == nil {
-		bw.o.pendingrequests = new(int64)
+	if o.numwrite == nil {
+		o.numwrite = new(int64)
 	}
 
-	if bw.o.numwrite == nil {
-		bw.o.numwrite = new(int64)
+	po := pipeline.NewOption().
+		SetMode(pipeline.ManualMode).
+		SetCapacity(o.maxinflights).
+		SetTimeout(o.timeout).
+		SetFlushInterval(o.maxFlushDelay).
+		SetMetrics(metrics{o}).
+		SetErrors(pipeline.Errors{
+			Closed:         ErrBatchWriterClosed,
+			TooManyWrite:   ErrBatchWriterTooManyWrite,
+			ActivelyClosed: ErrBatchWriterAtivelyClose,
+		})
+	if o.blockwrite {
+		po.AllowBlockForever()
+	}
+	if o.adaptive != nil {
+		po.SetAdaptiveFlush(*o.adaptive)
+	}
+	if o.histograms {
+		po.EnableHistograms()
 	}
 
-	if bw.o.workerPool != nil {
-		bw.o.workerPool.Serve(bw)
-	} else {
+	p, err := pipeline.New(w, po)
+	if err != nil {
+		return nil, err
+	}
+
+	bw := &BatchWriter{
+		w: w,
+		o: o,
+		p: p,
+	}
+
+	// the writer of workerpool is scheduled once it has pending data
+	if bw.o.workerPool == nil {
 		if bw.o.mode == FlushWriteMode {
 			go bw.DoWrite()
 		} else if bw.o.mode == ManualWriteMode {
@@ -158,12 +230,12 @@ func NewBatchWriter(o *Option, w io.Writer) (*BatchWriter, error) {
 
 // GetInflightsLen gets the length of the inflights.
 func (bw *BatchWriter) GetInflightsLen() int {
-	return len(bw.inflights)
+	return bw.p.Len()
 }
 
 // GetInflightsCap gets the cap of the inflights.
 func (bw *BatchWriter) GetInflightsCap() int {
-	return cap(bw.inflights)
+	return bw.p.Cap()
 }
 
 // GetNumRequests gets number of processed requests.
@@ -181,55 +253,65 @@ func (bw *BatchWriter) GetBytesWritten() int64 {
 	return atomic.LoadInt64(bw.o.numwrite)
 }
 
+// GetFlushDelay gets the flush delay chosen by the adaptive flush.
+func (bw *BatchWriter) GetFlushDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&bw.o.flushdelay))
+}
+
+// GetBatchSize gets the batch size chosen by the adaptive flush.
+func (bw *BatchWriter) GetBatchSize() int64 {
+	return atomic.LoadInt64(&bw.o.batchsize)
+}
+
+// GetHistograms gets the histograms, it's nil unless the histograms are enabled.
+func (bw *BatchWriter) GetHistograms() *pipeline.Histograms {
+	return bw.p.GetHistograms()
+}
+
 // IsClosed indicates whether writer was closed.
 func (bw *BatchWriter) IsClosed() bool {
-	return atomic.LoadUint32(&bw.closed) == 1
+	return bw.p.IsClosed()
 }
 
-// Close closes the writer.
+// Close closes the writer. It fails the writer with ErrBatchWriterPoolStopped instead if
+// its workerpool was stopped thus the pending records are completed without a worker.
 func (bw *BatchWriter) Close() error {
-	if !atomic.CompareAndSwapUint32(&bw.closed, 0, 1) {
-		return ErrBatchWriterClosed
+	if err := bw.checkPool(); err != nil {
+		return err
 	}
 
-	// try to nil to channel indicates close
-	bw.inflights <- nil
-
-	return nil
+	err := bw.p.Close()
+	bw.schedule()
+	return err
 }
 
 // Write implements io.Writer.
 func (bw *BatchWriter) Write(d []byte) (int, error) {
-	if len(d) == 0 { // avoid send nil buffer
-		return 0, nil
-	}
-
-	if err := bw.werr.Load(); err != nil {
+	if err := bw.checkPool(); err != nil {
 		return 0, err
 	}
 
-	if bw.IsClosed() {
-		return 0, ErrBatchWriterClosed
-	}
+	n, err := bw.p.Write(d)
+	bw.schedule()
+	return n, err
+}
 
-	if !bw.o.blockwrite {
-		if atomic.LoadInt64(bw.o.pendingrequests) >= int64(bw.o.maxinflights) {
-			return 0, ErrBatchWriterTooManyWrite
-		}
+// WriteCallback writes d and calls done once it was delivered or failed, e.g. the caller
+// batching the RPC responses learns which frames failed. done is not called if
+// WriteCallback returns an error.
+func (bw *BatchWriter) WriteCallback(d []byte, done pipeline.Callback) (int, error) {
+	if err := bw.checkPool(); err != nil {
+		return 0, err
 	}
 
-	atomic.AddInt64(bw.o.numrequests, 1)
-	atomic.AddInt64(bw.o.pendingrequests, 1)
-
-	b := acquireBuffer()
-	*b = append((*b)[:0], d...)
-	nd := len(d)
-	bw.inflights <- b
-
-	return nd, nil
+	n, err := bw.p.WriteCallback(d, done)
+	bw.schedule()
+	return n, err
 }
 
-// BatchWrite wraps the bw.DoWritev to use workerPool.
+// BatchWrite is the handler of workerpool which serves the writer for one turn: it flushes
+// at most one batch (maxinflights records) then releases the worker, the writer is scheduled
+// again if it still has pending data thus the writers sharing the workerpool take turns.
 //
 // nolint
 func BatchWrite(v interface{}) {
@@ -238,189 +320,106 @@ func BatchWrite(v interface{}) {
 		panic("failed to type casting")
 	}
 
-	bw.DoWritev()
+	bw.serve()
 }
 
-func (bw *BatchWriter) DoWrite() error {
-	ilen := cap(bw.inflights)
-	ctx := acquireContext(ilen)
-
-	var (
-		d               *[]byte
-		n               int
-		err             error
-		flushTimer      = getFlushTimer()
-		flushCh         <-chan time.Time
-		flushAlwaysCh   = make(chan time.Time)
-		pendingrequests int64
-	)
-
-	close(flushAlwaysCh)
-
-SENDLOOP:
-	for {
-		select {
-		case d = <-bw.inflights:
-		default:
-			// slow path
-			select {
-			case <-flushCh:
-				if len(ctx.buffer) > 0 {
-					if bw.o.timeout != 0 {
-						if ctx.conn != nil { // can set timeout
-							if err = ctx.conn.SetWriteDeadline(time.Now().Add(bw.o.timeout)); err != nil {
-								break SENDLOOP
-							}
-						}
-					}
-					n, err = bw.w.Write(ctx.buffer)
-					if err != nil {
-						break SENDLOOP
-					}
-					atomic.AddInt64(bw.o.numwrite, int64(n))
-					ctx.buffer = ctx.buffer[:0]
-					atomic.AddInt64(bw.o.pendingrequests, -pendingrequests)
-					pendingrequests = 0
-				}
-				flushCh = nil
-				continue
-
-			case d = <-bw.inflights:
-			}
-		}
-
-		if d == nil || len(*d) == 0 {
-			err = ErrBatchWriterAtivelyClose
-			break SENDLOOP
-		}
+const (
+	minScheduleBackoff = time.Millisecond
+	maxScheduleBackoff = 100 * time.Millisecond
+)
 
-		ctx.buffer = append(ctx.buffer, *d...)
-		releaseBuffer(d)
-		pendingrequests++
-
-		if flushCh == nil {
-			if bw.o.maxFlushDelay > 0 {
-				resetFlushTimer(flushTimer, bw.o.maxFlushDelay)
-				flushCh = flushTimer.C
-			} else {
-				flushCh = flushAlwaysCh
-			}
-		}
+// schedule dispatches the writer to workerpool unless it was scheduled.
+func (bw *BatchWriter) schedule() {
+	if bw.o.workerPool == nil {
+		return
 	}
 
-	putFlushTimer(flushTimer)
-	releaseContext(ctx)
-
-	// store the write error and set the closed status
-	bw.werr.Store(err)
-	atomic.StoreUint32(&bw.closed, 1)
-
-	// cleanup pending inflights
-	for len(bw.inflights) > 0 {
-		select {
-		case d := <-bw.inflights:
-			if d != nil {
-				releaseBuffer(d)
-			}
-		default:
-		}
+	if atomic.LoadUint32(&bw.scheduled) == 0 && atomic.CompareAndSwapUint32(&bw.scheduled, 0, 1) {
+		bw.dispatch(minScheduleBackoff)
 	}
-
-	return err
 }
 
-func (bw *BatchWriter) DoWritev() error {
-	ilen := cap(bw.inflights)
-	ctx := acquireContext(ilen)
-
-	// see whether it's net.Conn
-	ctx.conn, _ = bw.w.(net.Conn)
-	var (
-		d   *[]byte
-		nw  int64
-		n   int
-		err error
-	)
-
-SENDLOOP:
-	for {
-		d = <-bw.inflights
-		if d == nil || len(*d) == 0 {
-			err = ErrBatchWriterAtivelyClose
-			break
-		}
-		ctx.buffers = append(ctx.buffers[:0], *d)
-		ctx.buffersp = append(ctx.buffersp[:0], d)
-
-		for i := 0; i < ilen; i++ {
-			select {
-			case d = <-bw.inflights:
-				if d == nil || len(*d) == 0 {
-					err = ErrBatchWriterAtivelyClose
-					break SENDLOOP
-				}
-				ctx.buffers = append(ctx.buffers, *d)
-				ctx.buffersp = append(ctx.buffersp, d)
-			default:
-			}
-		}
+// dispatch serves the scheduled writer by workerpool, it retries after backoff if the workerpool
+// is saturated thus the writer waits without holding a worker and the pending data is kept.
+// It fails the writer once the workerpool was stopped.
+func (bw *BatchWriter) dispatch(backoff time.Duration) {
+	if bw.o.workerPool.Serve(bw) {
+		return
+	}
 
-		if bw.o.timeout != 0 {
-			if ctx.conn != nil { // can set timeout
-				if err = ctx.conn.SetWriteDeadline(time.Now().Add(bw.o.timeout)); err != nil {
-					break
-				}
-			}
-		}
+	if bw.o.workerPool.IsStopped() {
+		bw.fail()
+		return
+	}
 
-		if len(ctx.buffers) == 1 { // one iov: use raw write
-			n, err = bw.w.Write(ctx.buffers[0])
-			nw = int64(n)
+	next := backoff * 2
+	if next > maxScheduleBackoff {
+		next = maxScheduleBackoff
+	}
+	time.AfterFunc(backoff, func() { bw.dispatch(next) })
+}
 
-		} else {
-			ctx.netbuffers = net.Buffers(ctx.buffers)
-			// TODO: check partial writev
-			nw, err = ctx.netbuffers.WriteTo(bw.w)
-		}
+// checkPool fails the writer once its workerpool was stopped thus the writes return
+// ErrBatchWriterPoolStopped instead of piling up without being flushed.
+func (bw *BatchWriter) checkPool() error {
+	if bw.o.workerPool == nil || !bw.o.workerPool.IsStopped() {
+		return nil
+	}
 
-		atomic.AddInt64(bw.o.numwrite, nw)
-		if err != nil {
-			break SENDLOOP
-		}
-		atomic.AddInt64(bw.o.pendingrequests, -int64(len(ctx.buffers)))
+	bw.fail()
+	return ErrBatchWriterPoolStopped
+}
 
-		ctx.buffers = ctx.buffers[:0]
-		for j := range ctx.buffersp {
-			releaseBuffer(ctx.buffersp[j])
-		}
-		ctx.buffersp = ctx.buffersp[:0]
+// fail completes the pending records with ErrBatchWriterPoolStopped and unschedules the
+// writer, the error of the pipeline is kept if it has failed.
+func (bw *BatchWriter) fail() {
+	bw.p.Fail(ErrBatchWriterPoolStopped)
+	atomic.StoreUint32(&bw.scheduled, 0)
+}
 
-		if err != nil {
-			break SENDLOOP
-		}
+// serve runs one turn of the scheduled writer.
+func (bw *BatchWriter) serve() {
+	n, err := bw.p.FlushOnce(bw.o.maxinflights)
+	if err != nil {
+		// the writer was closed or failed, keep it scheduled thus it's never dispatched again
+		return
 	}
 
-	for j := range ctx.buffersp {
-		releaseBuffer(ctx.buffersp[j])
+	if n >= bw.o.maxinflights {
+		// yield the worker to the others and continue at the next turn
+		bw.dispatch(minScheduleBackoff)
+		return
 	}
-	ctx.buffersp = ctx.buffersp[:0]
-
-	releaseContext(ctx)
-
-	// store the write error and set the closed status
-	bw.werr.Store(err)
-	atomic.StoreUint32(&bw.closed, 1)
-
-	// cleanup pending inflights
-	for len(bw.inflights) > 0 {
-		select {
-		case d := <-bw.inflights:
-			if d != nil {
-				releaseBuffer(d)
-			}
-		default:
-		}
+
+	atomic.StoreUint32(&bw.scheduled, 0)
+	// the data written after flushed but before unscheduled
+	if bw.p.Len() > 0 {
+		bw.schedule()
 	}
+}
 
-	return err
+// DoWrite runs the write loop which copies the buffers into one until closed or failed to write.
+func (bw *BatchWriter) DoWrite() error {
+	return bw.p.RunMode(pipeline.FlushMode)
+}
+
+// DoWritev runs the write loop which writes the buffers by writev until closed or failed to write.
+func (bw *BatchWriter) DoWritev() error {
+	return bw.p.RunMode(pipeline.WritevMode)
+}
+
+// FlushOnce flushes at most max pending records (all of the available records if max <= 0)
+// without a goroutine, it's used to drive the writer of ManualWriteMode.
+func (bw *BatchWriter) FlushOnce(max int) (int, error) {
+	return bw.p.FlushOnce(max)
+}
+
+// FlushUntil flushes the pending records until there is no record or the deadline passed.
+func (bw *BatchWriter) FlushUntil(deadline time.Time) (int, error) {
+	return bw.p.FlushUntil(deadline)
+}
+
+// Pending returns the iterator which pops the pending records, see pipeline.Pipeline.Pending.
+func (bw *BatchWriter) Pending() *pipeline.Iterator {
+	return bw.p.Pending()
 }
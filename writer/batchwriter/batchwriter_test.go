@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	workerpool "github.com/sofastack/sofa-common-go/syncpool/fast-workerpool"
 	"github.com/stretchr/testify/require"
 	uatomic "go.uber.org/atomic"
 )
@@ -94,3 +95,304 @@ func TestBatchWriter(t *testing.T) {
 	_, err = bw.Write([]byte("abcd"))
 	require.Equal(t, io.EOF, err)
 }
+
+func TestBatchWriterManualWriteMode(t *testing.T) {
+	mw := &Buffer{}
+
+	bw, err := NewBatchWriter(NewOption().SetWriteMode(ManualWriteMode).SetMaxinflights(8), mw)
+	require.Nil(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = bw.Write([]byte("0123456789"))
+		require.Nil(t, err)
+	}
+
+	n, err := bw.FlushOnce(2)
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, strings.Repeat("0123456789", 2), mw.String())
+	require.Equal(t, int64(3), bw.GetPendingRequests())
+
+	n, err = bw.FlushUntil(time.Now().Add(time.Second))
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, strings.Repeat("0123456789", 5), mw.String())
+	require.Equal(t, int64(0), bw.GetPendingRequests())
+
+	n, err = bw.FlushOnce(0)
+	require.Nil(t, err)
+	require.Equal(t, 0, n)
+
+	_, err = bw.Write([]byte("abcd"))
+	require.Nil(t, err)
+	_, err = bw.Write([]byte("efgh"))
+	require.Nil(t, err)
+
+	var out []byte
+	it := bw.Pending()
+	for it.Next() {
+		out = append(out, it.Bytes()...)
+	}
+	require.Nil(t, it.Close())
+	require.Equal(t, "abcdefgh", string(out))
+	require.Equal(t, int64(0), bw.GetPendingRequests())
+
+	require.Nil(t, bw.Close())
+	_, err = bw.FlushOnce(0)
+	require.Equal(t, ErrBatchWriterAtivelyClose, err)
+	_, err = bw.Write([]byte("abcd"))
+	require.Equal(t, ErrBatchWriterAtivelyClose, err)
+}
+
+func TestBatchWriterWriteCallback(t *testing.T) {
+	mw := &Buffer{}
+
+	bw, err := NewBatchWriter(NewOption().SetWriteMode(ManualWriteMode), mw)
+	require.Nil(t, err)
+
+	var results []error
+	done := func(err error) { results = append(results, err) }
+
+	_, err = bw.WriteCallback([]byte("abcd"), done)
+	require.Nil(t, err)
+	n, err := bw.FlushOnce(0)
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, []error{nil}, results)
+
+	mw.SetWriteError(io.EOF)
+	_, err = bw.WriteCallback([]byte("efgh"), done)
+	require.Nil(t, err)
+	_, err = bw.FlushOnce(0)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, []error{nil, io.EOF}, results)
+	require.Equal(t, int64(0), bw.GetPendingRequests())
+	require.Equal(t, int64(4), bw.GetBytesWritten())
+}
+
+// blockWriter blocks the writes until unblocked.
+type blockWriter struct {
+	Buffer
+	unblock chan struct{}
+}
+
+func (s *blockWriter) Write(p []byte) (int, error) {
+	<-s.unblock
+	return s.Buffer.Write(p)
+}
+
+func TestBatchWriterWorkerPoolShared(t *testing.T) {
+	wp, err := workerpool.New(workerpool.HandlerFunc(BatchWrite), workerpool.WithWorkerPoolMaxWorkersCount(2))
+	require.Nil(t, err)
+	wp.Start()
+	defer wp.Stop()
+
+	// more writers than workers: a writer only holds a worker while it has pending data
+	const writers = 16
+	mws := make([]*Buffer, writers)
+	bws := make([]*BatchWriter, writers)
+	for i := range bws {
+		mws[i] = &Buffer{}
+		bws[i], err = NewBatchWriter(NewOption().BlockWriteForever().SetMaxinflights(4).SetWorkerPool(wp), mws[i])
+		require.Nil(t, err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(writers)
+	for i := range bws {
+		go func(bw *BatchWriter) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := bw.Write([]byte("0123456789"))
+				require.Nil(t, err)
+			}
+		}(bws[i])
+	}
+	wg.Wait()
+
+	for i := range bws {
+		bw, mw := bws[i], mws[i]
+		require.Eventually(t, func() bool {
+			return bw.GetPendingRequests() == 0
+		}, 5*time.Second, time.Millisecond)
+		require.Equal(t, strings.Repeat("0123456789", 100), mw.String())
+		require.Nil(t, bw.Close())
+	}
+
+	for i := range bws {
+		bw := bws[i]
+		require.Eventually(t, func() bool {
+			_, err := bw.Write([]byte("abcd"))
+			return err == ErrBatchWriterAtivelyClose
+		}, time.Second, time.Millisecond)
+	}
+}
+
+func TestBatchWriterWorkerPoolSaturated(t *testing.T) {
+	wp, err := workerpool.New(workerpool.HandlerFunc(BatchWrite), workerpool.WithWorkerPoolMaxWorkersCount(1))
+	require.Nil(t, err)
+	wp.Start()
+	defer wp.Stop()
+
+	// the blocked writer holds the only worker
+	bmw := &blockWriter{unblock: make(chan struct{})}
+	bbw, err := NewBatchWriter(NewOption().SetWorkerPool(wp), bmw)
+	require.Nil(t, err)
+	_, err = bbw.Write([]byte("abcd"))
+	require.Nil(t, err)
+
+	mw := &Buffer{}
+	bw, err := NewBatchWriter(NewOption().SetWorkerPool(wp), mw)
+	require.Nil(t, err)
+	_, err = bw.Write([]byte("efgh"))
+	require.Nil(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, "", mw.String())
+	require.Equal(t, int64(1), bw.GetPendingRequests())
+
+	// the writer is dispatched once the worker is released
+	close(bmw.unblock)
+	require.Eventually(t, func() bool {
+		return mw.String() == "efgh" && bmw.String() == "abcd"
+	}, time.Second, time.Millisecond)
+}
+
+func TestBatchWriterWorkerPoolStopped(t *testing.T) {
+	wp, err := workerpool.New(workerpool.HandlerFunc(BatchWrite), workerpool.WithWorkerPoolMaxWorkersCount(1))
+	require.Nil(t, err)
+
+	// the blocked writer holds the only worker thus the other writer keeps retrying
+	bmw := &blockWriter{unblock: make(chan struct{})}
+	defer close(bmw.unblock)
+	bbw, err := NewBatchWriter(NewOption().SetWorkerPool(wp), bmw)
+	require.Nil(t, err)
+	_, err = bbw.Write([]byte("abcd"))
+	require.Nil(t, err)
+
+	mw := &Buffer{}
+	bw, err := NewBatchWriter(NewOption().SetWorkerPool(wp), mw)
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	_, err = bw.WriteCallback([]byte("efgh"), func(err error) { done <- err })
+	require.Nil(t, err)
+
+	wp.Stop()
+
+	// the pending data is failed instead of piling up
+	select {
+	case err = <-done:
+		require.Equal(t, ErrBatchWriterPoolStopped, err)
+	case <-time.After(time.Second):
+		t.Fatal("the pending write was never completed")
+	}
+	require.Equal(t, int64(0), bw.GetPendingRequests())
+
+	_, err = bw.Write([]byte("ijkl"))
+	require.Equal(t, ErrBatchWriterPoolStopped, err)
+	require.Equal(t, ErrBatchWriterPoolStopped, bw.Close())
+	require.Equal(t, "", mw.String())
+}
+
+func TestBatchWriterWorkerPoolStoppedFull(t *testing.T) {
+	for _, block := range []bool{false, true} {
+		wp, err := workerpool.New(workerpool.HandlerFunc(BatchWrite), workerpool.WithWorkerPoolMaxWorkersCount(1))
+		require.Nil(t, err)
+
+		// the blocked writer holds the only worker thus the queue of the other one is never consumed
+		bmw := &blockWriter{unblock: make(chan struct{})}
+		bbw, err := NewBatchWriter(NewOption().SetWorkerPool(wp), bmw)
+		require.Nil(t, err)
+		_, err = bbw.Write([]byte("abcd"))
+		require.Nil(t, err)
+
+		o := NewOption().SetMaxinflights(2).SetWorkerPool(wp)
+		if block {
+			o.BlockWriteForever()
+		}
+		mw := &Buffer{}
+		bw, err := NewBatchWriter(o, mw)
+		require.Nil(t, err)
+
+		done := make(chan error, 3)
+		for i := 0; i < 2; i++ {
+			_, err = bw.WriteCallback([]byte("efgh"), func(err error) { done <- err })
+			require.Nil(t, err)
+		}
+		require.Equal(t, bw.GetInflightsCap(), bw.GetInflightsLen())
+
+		// the write blocked by the full queue returns once the pool was stopped
+		blocked := make(chan error, 1)
+		if block {
+			go func() {
+				_, err := bw.WriteCallback([]byte("ijkl"), func(err error) { done <- err })
+				blocked <- err
+			}()
+		} else {
+			_, err = bw.Write([]byte("ijkl"))
+			require.Equal(t, ErrBatchWriterTooManyWrite, err)
+		}
+
+		wp.Stop()
+
+		_, err = bw.Write([]byte("mnop"))
+		require.Equal(t, ErrBatchWriterPoolStopped, err)
+		require.Equal(t, ErrBatchWriterPoolStopped, bw.Close())
+
+		for i := 0; i < 2; i++ {
+			select {
+			case err = <-done:
+				require.Equal(t, ErrBatchWriterPoolStopped, err)
+			case <-time.After(time.Second):
+				t.Fatal("the queued write was never completed")
+			}
+		}
+
+		if block {
+			select {
+			case err = <-blocked:
+				if err == nil {
+					require.Equal(t, ErrBatchWriterPoolStopped, <-done)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("the blocked write never returned")
+			}
+		}
+
+		require.Equal(t, int64(0), bw.GetPendingRequests())
+		require.Equal(t, "", mw.String())
+		close(bmw.unblock)
+	}
+}
+
+func TestBatchWriterCloseAfterPoolStopped(t *testing.T) {
+	wp, err := workerpool.New(workerpool.HandlerFunc(BatchWrite), workerpool.WithWorkerPoolMaxWorkersCount(1))
+	require.Nil(t, err)
+
+	bmw := &blockWriter{unblock: make(chan struct{})}
+	defer close(bmw.unblock)
+	bbw, err := NewBatchWriter(NewOption().SetWorkerPool(wp), bmw)
+	require.Nil(t, err)
+	_, err = bbw.Write([]byte("abcd"))
+	require.Nil(t, err)
+
+	bw, err := NewBatchWriter(NewOption().SetMaxinflights(1).SetWorkerPool(wp), &Buffer{})
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	_, err = bw.WriteCallback([]byte("efgh"), func(err error) { done <- err })
+	require.Nil(t, err)
+
+	// Close fails the writer before closing the full queue
+	wp.Stop()
+	closed := make(chan error, 1)
+	go func() { closed <- bw.Close() }()
+
+	select {
+	case err = <-closed:
+		require.Equal(t, ErrBatchWriterPoolStopped, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close never returned")
+	}
+	require.Equal(t, ErrBatchWriterPoolStopped, <-done)
+	require.True(t, bw.IsClosed())
+}
@@ -0,0 +1,95 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package dsn
+
+import (
+	"net/url"
+)
+
+// Builder builds the DSN programmatically instead of concatenating strings, e.g.
+//
+//	d, err := dsn.NewBuilder("file").
+//	    SetPath("/home/admin/logs/app.log").
+//	    SetQuery(dsn.RotateMode, "time").
+//	    SetQuery(dsn.RotateTime, "1h").
+//	    Build()
+type Builder struct {
+	u     url.URL
+	query url.Values
+}
+
+// NewBuilder returns a builder of the scheme.
+func NewBuilder(scheme string) *Builder {
+	return &Builder{
+		u:     url.URL{Scheme: scheme},
+		query: make(url.Values),
+	}
+}
+
+// SetHost sets the host e.g. "127.0.0.1:514".
+func (b *Builder) SetHost(host string) *Builder {
+	b.u.Host = host
+	return b
+}
+
+// SetPath sets the path e.g. "/home/admin/logs/app.log".
+func (b *Builder) SetPath(path string) *Builder {
+	b.u.Path = path
+	return b
+}
+
+// SetUser sets the username.
+func (b *Builder) SetUser(username string) *Builder {
+	b.u.User = url.User(username)
+	return b
+}
+
+// SetUserPassword sets the username and password.
+func (b *Builder) SetUserPassword(username, password string) *Builder {
+	b.u.User = url.UserPassword(username, password)
+	return b
+}
+
+// SetQuery sets the value of key, it replaces the existing values.
+func (b *Builder) SetQuery(key, value string) *Builder {
+	b.query.Set(key, value)
+	return b
+}
+
+// AddQuery adds the value to key.
+func (b *Builder) AddQuery(key, value string) *Builder {
+	b.query.Add(key, value)
+	return b
+}
+
+// DelQuery deletes the values of key.
+func (b *Builder) DelQuery(key string) *Builder {
+	b.query.Del(key)
+	return b
+}
+
+// Build returns the DSN, the values of the secret keys with the "file:" prefix are replaced
+// by the content of the files as NewDSN does, but the environment variables are not expanded.
+// The DSN is validated when the writer is built from it, or by Validate.
+func (b *Builder) Build() (*DSN, error) {
+	u := b.u
+	u.RawQuery = b.query.Encode()
+
+	secrets, err := resolveSecrets(&u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DSN{u: &u, secrets: secrets}, nil
+}
@@ -0,0 +1,141 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package dsn
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Canonical returns the equivalent DSN in canonical form: the scheme and host are lower-cased,
+// the path is re-encoded, the empty values and the values equal to the defaults of schema are
+// removed, the values are canonicalized by their types and the query keys are sorted.
+func (d *DSN) Canonical() *DSN {
+	u := *d.u
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.RawPath = ""
+	u.ForceQuery = false
+
+	schema, _ := LookupSchema(u.Scheme)
+
+	q := u.Query()
+	for name, values := range q {
+		var key *Key
+		if schema != nil {
+			key, _ = schema.GetKey(name)
+		}
+
+		cvs := make([]string, 0, len(values))
+		for _, v := range values {
+			if v == "" {
+				continue
+			}
+			if key != nil {
+				v = key.Type.canonical(v)
+			}
+			cvs = append(cvs, v)
+		}
+
+		if key != nil && key.Default != "" && len(cvs) == 1 && cvs[0] == key.Type.canonical(key.Default) {
+			cvs = cvs[:0]
+		}
+
+		if len(cvs) == 0 {
+			delete(q, name)
+		} else {
+			q[name] = cvs
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return &DSN{u: &u, secrets: d.secrets}
+}
+
+// Equal reports whether the DSNs are equivalent after canonicalized.
+func (d *DSN) Equal(o *DSN) bool {
+	return d.Canonical().u.String() == o.Canonical().u.String()
+}
+
+// Change is a difference between two DSNs.
+type Change struct {
+	// Key is either "scheme", "user", "host", "path" or the query key.
+	Key  string
+	From string
+	To   string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Key, c.From, c.To)
+}
+
+// Diff returns the changes from d to o after canonicalized, the secrets are redacted.
+func (d *DSN) Diff(o *DSN) []Change {
+	a, b := d.Canonical(), o.Canonical()
+
+	var changes []Change
+	// add compares the raw values and records the redacted values
+	add := func(key, from, to, rfrom, rto string) {
+		if from == to {
+			return
+		}
+		if rfrom == rto { // both are redacted
+			rfrom, rto = RedactedValue+"(old)", RedactedValue+"(new)"
+		}
+		changes = append(changes, Change{Key: key, From: rfrom, To: rto})
+	}
+
+	add("scheme", a.u.Scheme, b.u.Scheme, a.u.Scheme, b.u.Scheme)
+	add("user", a.u.User.String(), b.u.User.String(), redactUser(a.u.User), redactUser(b.u.User))
+	add("host", a.u.Host, b.u.Host, a.u.Host, b.u.Host)
+	add("path", a.u.Path, b.u.Path, a.u.Path, b.u.Path)
+
+	qa, qb := a.u.Query(), b.u.Query()
+	names := make([]string, 0, len(qa)+len(qb))
+	for name := range qa {
+		names = append(names, name)
+	}
+	for name := range qb {
+		if _, ok := qa[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		from, to := strings.Join(qa[name], ","), strings.Join(qb[name], ",")
+		rfrom, rto := from, to
+		if s, ok := a.secrets[name]; ok && from != "" {
+			rfrom = s
+		}
+		if s, ok := b.secrets[name]; ok && to != "" {
+			rto = s
+		}
+		add(name, from, to, rfrom, rto)
+	}
+
+	return changes
+}
+
+func redactUser(u *url.Userinfo) string {
+	if u == nil {
+		return ""
+	}
+	if _, ok := u.Password(); ok {
+		return u.Username() + ":" + RedactedValue
+	}
+	return u.Username()
+}
@@ -14,7 +14,9 @@
 package dsn
 
 import (
+	"fmt"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -25,17 +27,33 @@ import (
 //nolint
 const (
 	RotateMode    = "rotate_mode" // "size" or "time", default to size
-	MaxSizeKey    = "maxsize"
+	MaxSizeKey    = "maxsize"     // e.g. "512MiB", "1GB", the bare number is in megabytes
 	MaxBackupsKey = "maxbackups"  // conflict with maxage under time mode
-	MaxAgeKey     = "maxage"      // unit: days
+	MaxAgeKey     = "maxage"      // e.g. "7d", "1w", "36h", the bare number is in days. rounded up to days under size mode
 	CompressKey   = "compress"    // only available under size mode
-	RotateTime    = "rotate_time" // only available under time mode. format: "2m", "1h", "1d", units are minute, hour, day
+	RotateTime    = "rotate_time" // only available under time mode. e.g. "2m", "1h", "1d", "1h30m"
 
 	// filename_pattern is only available under time mode. default to "<log-filename>.%Y-%m-%d_%H".
 	// This must be used carefully with percent encoding as the following:
 	//     unix:///home/admin/logs/rpc-client-digest?rotate_mode=time&filename_pattern=rpc-client-digest.log.%25Y-%25m-%25d_%25H&rotate_time=1h
 	FilenamePattern = "filename_pattern"
 
+	// multi_process coordinates the rotation by flock on "<log-filename>.lock" thus the
+	// file can be shared among multiple processes.
+	MultiProcessKey = "multi_process"
+
+	// reopen_watch checks the file every interval (e.g. "1s") and reopens it once it was moved
+	// or removed (e.g. by logrotate without copytruncate), it's disabled if empty or zero.
+	ReopenWatchKey = "reopen_watch"
+
+	// The disk guard degrades the file writer once the file system is lower than disk_min_free
+	// (e.g. "1GiB", the bare number is in megabytes) or disk_min_free_inodes. It deletes the
+	// oldest backups if disk_delete_backups and drops the DEBUG/INFO records if disk_drop_low_level.
+	DiskMinFreeKey       = "disk_min_free"
+	DiskMinFreeInodesKey = "disk_min_free_inodes"
+	DiskDeleteBackupsKey = "disk_delete_backups"
+	DiskDropLowLevelKey  = "disk_drop_low_level"
+
 	RsyslogAppNameKey     = "rsyslog_appname"
 	RsyslogSeverityKey    = "rsyslog_severity"
 	RsyslogFacilityKey    = "rsyslog_facility"
@@ -43,26 +61,85 @@ const (
 	AsyncBatchKey         = "async_batch"
 	AsyncBlockKey         = "async_block"
 	AsyncFlushIntervalKey = "async_flush_interval"
+	AsyncQueueKey         = "async_queue" // "channel" or "sharded", default to channel
+	AsyncHistogramsKey    = "async_histograms"
+
+	LevelKey   = "level"
+	LenientKey = "lenient" // skip the schema validation for compatibility
+
+	// The filters of the destination, the values are comma separated.
+	// The logger names match the name itself and its children e.g. "rpc" matches "rpc.client".
+	// The fields are either "key" or "key:value" e.g. include_field=tenant:alipay,trace.
+	IncludeLoggerKey = "include_logger"
+	ExcludeLoggerKey = "exclude_logger"
+	IncludeFieldKey  = "include_field"
+	ExcludeFieldKey  = "exclude_field"
+
+	TestDiscardKey = "discard"
+	TestTraceKey   = "trace"
 )
 
 type DSNList struct {
-	d []*DSN
+	d   []*DSN
+	sep string
 }
 
 type DSN struct {
-	u *url.URL
+	u       *url.URL
+	secrets map[string]string // the redacted values of the secret query keys
 }
 
+// NewDSN parses the dsn after expanding the ${VAR} and ${VAR:-default} environment variables
+// (the values expanded in query are query escaped), the values of the secret keys with the
+// "file:" prefix are replaced by the content of the files.
 func NewDSN(dsn string) (*DSN, error) {
+	dsn, err := interpolate(dsn, os.LookupEnv, true)
+	if err != nil {
+		return nil, err
+	}
+
 	u, err := url.Parse(dsn)
 	if err != nil {
 		return nil, err
 	}
-	return &DSN{u: u}, nil
+
+	secrets, err := resolveSecrets(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DSN{u: u, secrets: secrets}, nil
 }
 
+// String returns the dsn with the secrets redacted, the secrets read from files
+// are shown as their references.
 func (d *DSN) String() string {
-	return d.u.String()
+	if len(d.secrets) == 0 && d.u.User == nil {
+		return d.u.String()
+	}
+	return redact(d.u, d.secrets).String()
+}
+
+// Encode returns the dsn which is parsed by NewDSN into the equivalent DSN. Unlike String
+// the secrets are kept, except the ones read from files which are encoded as their references,
+// and "$" is percent-encoded thus it's never expanded again. Use String to display the DSN.
+func (d *DSN) Encode() string {
+	u := *d.u
+	if len(d.secrets) > 0 {
+		q := u.Query()
+		referred := false
+		for k, v := range d.secrets {
+			if strings.HasPrefix(v, SecretFilePrefix) {
+				q[k] = []string{v}
+				referred = true
+			}
+		}
+		if referred {
+			u.RawQuery = q.Encode()
+		}
+	}
+
+	return strings.ReplaceAll(u.String(), "$", "%24")
 }
 
 func (d *DSN) GetScheme() string {
@@ -81,6 +158,19 @@ func (d *DSN) GetQuery(key string) string {
 	return d.u.Query().Get(key)
 }
 
+// GetQueryOrDefault returns the value of key or the default value declared by schema.
+func (d *DSN) GetQueryOrDefault(key string) string {
+	if v := d.GetQuery(key); v != "" {
+		return v
+	}
+
+	if s, ok := LookupSchema(d.GetScheme()); ok {
+		return s.Default(key)
+	}
+
+	return ""
+}
+
 func NewDSNList(dsnlist string, sep string) (*DSNList, error) {
 	dd := make([]*DSN, 0, 10)
 	s := strings.Split(dsnlist, sep)
@@ -93,14 +183,60 @@ func NewDSNList(dsnlist string, sep string) (*DSNList, error) {
 	}
 
 	return &DSNList{
-		d: dd,
+		d:   dd,
+		sep: sep,
 	}, nil
 }
 
+// NewDSNListFrom returns a DSNList of dsns which is encoded with sep by String.
+func NewDSNListFrom(sep string, dsns ...*DSN) *DSNList {
+	return &DSNList{
+		d:   dsns,
+		sep: sep,
+	}
+}
+
 func (d *DSNList) Get() []*DSN {
 	return d.d
 }
 
+// GetSeparator returns the separator of DSNs.
+func (d *DSNList) GetSeparator() string {
+	return d.sep
+}
+
+// String returns the DSNs encoded by DSN.Encode joined by the separator, it can be parsed by
+// NewDSNList with the same separator. The separators in DSN are percent-encoded thus the
+// separator must not be used by the syntax of URL, e.g. "," or "|" but not "/".
+// The secrets are kept, use Redacted to display the DSNs.
+func (d *DSNList) String() string {
+	return d.join((*DSN).Encode)
+}
+
+// Redacted returns the DSNs joined by the separator with the secrets redacted like DSN.String.
+func (d *DSNList) Redacted() string {
+	return d.join((*DSN).String)
+}
+
+func (d *DSNList) join(encode func(*DSN) string) string {
+	var escaped string
+	if d.sep != "" {
+		for i := 0; i < len(d.sep); i++ {
+			escaped += fmt.Sprintf("%%%02X", d.sep[i])
+		}
+	}
+
+	ss := make([]string, len(d.d))
+	for i := range d.d {
+		ss[i] = encode(d.d[i])
+		if escaped != "" {
+			ss[i] = strings.ReplaceAll(ss[i], d.sep, escaped)
+		}
+	}
+
+	return strings.Join(ss, d.sep)
+}
+
 func ParseBool(s string, def bool) bool {
 	b, err := strconv.ParseBool(s)
 	if err != nil {
@@ -118,7 +254,7 @@ func ParseInt64(s string, def int64) int64 {
 }
 
 func ParseDuration(s string, d time.Duration) time.Duration {
-	t, err := time.ParseDuration(s)
+	t, err := ParseDurationUnit(s, 0)
 	if err != nil {
 		return d
 	}
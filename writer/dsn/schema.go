@@ -0,0 +1,351 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package dsn
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sofastack/sofa-common-go/writer/rsyslogwriter"
+	"go.uber.org/multierr"
+)
+
+// ValueType validates the value of key.
+type ValueType struct {
+	Name     string
+	Validate func(s string) error
+	// Canonicalize returns the canonical form of the valid value, e.g. "1GiB" to "1073741824B".
+	// The value is kept as it is if Canonicalize is nil.
+	Canonicalize func(s string) string
+}
+
+// canonical returns the canonical form of s, the invalid value is kept as it is.
+func (vt *ValueType) canonical(s string) string {
+	if vt.Canonicalize == nil || vt.Validate(s) != nil {
+		return s
+	}
+	return vt.Canonicalize(s)
+}
+
+var (
+	StringValue = &ValueType{Name: "string", Validate: func(s string) error { return nil }}
+	BoolValue   = &ValueType{Name: "bool", Validate: func(s string) error {
+		_, err := strconv.ParseBool(s)
+		return err
+	}, Canonicalize: func(s string) string {
+		b, _ := strconv.ParseBool(s)
+		return strconv.FormatBool(b)
+	}}
+	IntValue = &ValueType{Name: "int", Validate: func(s string) error {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err
+	}, Canonicalize: func(s string) string {
+		n, _ := strconv.ParseInt(s, 10, 64)
+		return strconv.FormatInt(n, 10)
+	}}
+	DurationValue = DurationUnitValue(0)
+	SeverityValue = &ValueType{Name: "severity", Validate: func(s string) error {
+		_, err := rsyslogwriter.ParseSeverity(s)
+		return err
+	}, Canonicalize: strings.ToUpper}
+	FacilityValue = &ValueType{Name: "facility", Validate: func(s string) error {
+		_, err := rsyslogwriter.ParseFacility(s)
+		return err
+	}, Canonicalize: strings.ToUpper}
+	MegabytesValue = SizeValue(MiB)
+	DaysValue      = DurationUnitValue(Day)
+)
+
+// SizeValue returns a ValueType which accepts the size, the bare number is in unit.
+func SizeValue(unit int64) *ValueType {
+	return &ValueType{Name: "size", Validate: func(s string) error {
+		_, err := ParseBytes(s, unit)
+		return err
+	}, Canonicalize: func(s string) string {
+		n, _ := ParseBytes(s, unit)
+		return strconv.FormatInt(n, 10) + "B"
+	}}
+}
+
+// DurationUnitValue returns a ValueType which accepts the duration, the bare number is in unit.
+func DurationUnitValue(unit time.Duration) *ValueType {
+	return &ValueType{Name: "duration", Validate: func(s string) error {
+		_, err := ParseDurationUnit(s, unit)
+		return err
+	}, Canonicalize: func(s string) string {
+		d, _ := ParseDurationUnit(s, unit)
+		return d.String()
+	}}
+}
+
+// EnumValue returns a ValueType which only accepts the values (case-insensitive).
+func EnumValue(values ...string) *ValueType {
+	return &ValueType{
+		Name: "enum",
+		Validate: func(s string) error {
+			for i := range values {
+				if strings.EqualFold(s, values[i]) {
+					return nil
+				}
+			}
+			return fmt.Errorf("want one of %s", strings.Join(values, ", "))
+		},
+		Canonicalize: strings.ToLower,
+	}
+}
+
+// Key declares a key of DSN query.
+type Key struct {
+	Name    string
+	Type    *ValueType
+	Default string
+}
+
+// Rule validates the DSN as a whole, e.g. the conflicts of keys.
+type Rule func(d *DSN) error
+
+// KeyError indicates the key of DSN is unknown or invalid.
+type KeyError struct {
+	Scheme string
+	Key    string
+	Value  string
+	Reason string
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("dsn: invalid key %q=%q of scheme %q: %s", e.Key, e.Value, e.Scheme, e.Reason)
+}
+
+// Schema declares the keys and rules of schemes.
+type Schema struct {
+	keys  map[string]*Key
+	rules []Rule
+}
+
+// NewSchema returns a new schema.
+func NewSchema() *Schema {
+	return &Schema{
+		keys: make(map[string]*Key, 16),
+	}
+}
+
+// AddKeys adds keys to schema.
+func (s *Schema) AddKeys(keys ...*Key) *Schema {
+	for i := range keys {
+		s.keys[keys[i].Name] = keys[i]
+	}
+	return s
+}
+
+// AddRules adds rules to schema.
+func (s *Schema) AddRules(rules ...Rule) *Schema {
+	s.rules = append(s.rules, rules...)
+	return s
+}
+
+// GetKey returns the key declared by schema.
+func (s *Schema) GetKey(name string) (*Key, bool) {
+	k, ok := s.keys[name]
+	return k, ok
+}
+
+// Default returns the default value of key.
+func (s *Schema) Default(name string) string {
+	if k, ok := s.keys[name]; ok {
+		return k.Default
+	}
+	return ""
+}
+
+// Validate validates the DSN, all of errors are combined. The empty values are not
+// validated since they are treated as the defaults, and the secret keys (see IsSecretKey)
+// are accepted as strings even if they are not declared.
+func (s *Schema) Validate(d *DSN) error {
+	var errs []error
+
+	query := d.u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		k, ok := s.keys[name]
+		if !ok && IsSecretKey(name) {
+			// the secrets e.g. token=file:/etc/secrets/token are accepted as strings
+			continue
+		}
+
+		for _, value := range query[name] {
+			if !ok {
+				errs = append(errs, &KeyError{Scheme: d.GetScheme(), Key: name, Value: value, Reason: "unknown key"})
+				continue
+			}
+
+			// the empty value is treated as the default
+			if value == "" {
+				continue
+			}
+
+			if err := k.Type.Validate(value); err != nil {
+				errs = append(errs, &KeyError{Scheme: d.GetScheme(), Key: name, Value: value,
+					Reason: fmt.Sprintf("invalid %s: %v", k.Type.Name, err)})
+			}
+		}
+	}
+
+	for i := range s.rules {
+		if err := s.rules[i](d); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return multierr.Combine(errs...)
+}
+
+var schemas sync.Map
+
+// RegisterSchema registers the schema of schemes.
+func RegisterSchema(s *Schema, schemes ...string) {
+	for i := range schemes {
+		schemas.Store(schemes[i], s)
+	}
+}
+
+// LookupSchema returns the schema of scheme.
+func LookupSchema(scheme string) (*Schema, bool) {
+	i, ok := schemas.Load(scheme)
+	if !ok {
+		return nil, false
+	}
+	return i.(*Schema), true
+}
+
+// Validate validates the DSN by the schema of its scheme, the unknown keys are rejected.
+// It skips the validation if the DSN is lenient (lenient=true is kept for compatibility
+// with the DSNs written before the schema) or there is no schema for the scheme.
+func Validate(d *DSN) error {
+	if ParseBool(d.GetQuery(LenientKey), false) {
+		return nil
+	}
+
+	s, ok := LookupSchema(d.GetScheme())
+	if !ok {
+		return nil
+	}
+
+	return s.Validate(d)
+}
+
+// OnlyUnder returns a rule which rejects the keys unless the value of modeKey is mode.
+func OnlyUnder(modeKey, mode string, keys ...string) Rule {
+	return func(d *DSN) error {
+		if strings.EqualFold(d.GetQueryOrDefault(modeKey), mode) {
+			return nil
+		}
+
+		var errs []error
+		for i := range keys {
+			if v := d.GetQuery(keys[i]); v != "" {
+				errs = append(errs, &KeyError{Scheme: d.GetScheme(), Key: keys[i], Value: v,
+					Reason: fmt.Sprintf("only available under %s=%s", modeKey, mode)})
+			}
+		}
+		return multierr.Combine(errs...)
+	}
+}
+
+// ConflictUnder returns a rule which rejects both of keys a and b are set if the value
+// of modeKey is mode.
+func ConflictUnder(modeKey, mode string, a, b string) Rule {
+	return func(d *DSN) error {
+		if !strings.EqualFold(d.GetQueryOrDefault(modeKey), mode) {
+			return nil
+		}
+
+		if d.GetQuery(a) != "" && d.GetQuery(b) != "" {
+			return &KeyError{Scheme: d.GetScheme(), Key: a, Value: d.GetQuery(a),
+				Reason: fmt.Sprintf("conflict with %s under %s=%s", b, modeKey, mode)}
+		}
+		return nil
+	}
+}
+
+var commonKeys = []*Key{
+	{Name: LenientKey, Type: BoolValue, Default: "false"},
+	// the destination without level follows the level of logger thus it has no default
+	{Name: LevelKey, Type: EnumValue("debug", "info", "warn", "error", "dpanic", "panic", "fatal")},
+	{Name: AsyncKey, Type: StringValue},
+	{Name: AsyncBatchKey, Type: IntValue, Default: "0"},
+	{Name: AsyncBlockKey, Type: BoolValue, Default: "false"},
+	{Name: AsyncFlushIntervalKey, Type: DurationValue, Default: "0s"},
+	{Name: AsyncQueueKey, Type: EnumValue("channel", "sharded"), Default: "channel"},
+	{Name: AsyncHistogramsKey, Type: BoolValue, Default: "false"},
+	{Name: IncludeLoggerKey, Type: StringValue},
+	{Name: ExcludeLoggerKey, Type: StringValue},
+	{Name: IncludeFieldKey, Type: StringValue},
+	{Name: ExcludeFieldKey, Type: StringValue},
+}
+
+// FileSchema is the schema of file, unix and empty scheme.
+var FileSchema = NewSchema().
+	AddKeys(commonKeys...).
+	AddKeys(
+		&Key{Name: RotateMode, Type: EnumValue("size", "time"), Default: "size"},
+		&Key{Name: MaxSizeKey, Type: MegabytesValue, Default: "0"},
+		&Key{Name: MaxBackupsKey, Type: IntValue, Default: "0"},
+		&Key{Name: MaxAgeKey, Type: DaysValue, Default: "0"},
+		&Key{Name: CompressKey, Type: BoolValue, Default: "false"},
+		&Key{Name: RotateTime, Type: DurationValue, Default: "1h"},
+		&Key{Name: FilenamePattern, Type: StringValue},
+		&Key{Name: MultiProcessKey, Type: BoolValue, Default: "false"},
+		&Key{Name: ReopenWatchKey, Type: DurationValue, Default: "0s"},
+		&Key{Name: DiskMinFreeKey, Type: MegabytesValue, Default: "0"},
+		&Key{Name: DiskMinFreeInodesKey, Type: IntValue, Default: "0"},
+		&Key{Name: DiskDeleteBackupsKey, Type: BoolValue, Default: "false"},
+		&Key{Name: DiskDropLowLevelKey, Type: BoolValue, Default: "false"},
+	).
+	AddRules(
+		OnlyUnder(RotateMode, "size", CompressKey),
+		OnlyUnder(RotateMode, "time", RotateTime, FilenamePattern),
+		ConflictUnder(RotateMode, "time", MaxBackupsKey, MaxAgeKey),
+	)
+
+// SyslogSchema is the schema of rsyslog and syslog scheme.
+var SyslogSchema = NewSchema().
+	AddKeys(commonKeys...).
+	AddKeys(
+		&Key{Name: RsyslogAppNameKey, Type: StringValue},
+		&Key{Name: RsyslogSeverityKey, Type: SeverityValue, Default: "INFO"},
+		&Key{Name: RsyslogFacilityKey, Type: FacilityValue, Default: "USER"},
+	)
+
+// TestSchema is the schema of test scheme.
+var TestSchema = NewSchema().
+	AddKeys(commonKeys...).
+	AddKeys(
+		&Key{Name: TestDiscardKey, Type: BoolValue, Default: "false"},
+		&Key{Name: TestTraceKey, Type: BoolValue, Default: "false"},
+	)
+
+func init() {
+	RegisterSchema(FileSchema, "", "file", "unix")
+	RegisterSchema(SyslogSchema, "rsyslog", "syslog")
+	RegisterSchema(TestSchema, "test")
+}
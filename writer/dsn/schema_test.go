@@ -0,0 +1,106 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package dsn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/multierr"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		dsn  string
+		errs []string
+	}{
+		{dsn: "unix:///tmp/app.log"},
+		{dsn: "unix:///tmp/app.log?rotate_mode=size&maxsize=1024&maxbackups=3&compress=true&level=debug"},
+		{dsn: "unix:///tmp/app.log?rotate_mode=time&rotate_time=1d&maxage=7&async=true&async_flush_interval=10ms"},
+		{dsn: "rsyslog://127.0.0.1:514?rsyslog_severity=err&rsyslog_facility=local0"},
+		{dsn: "test:///app?discard=true&trace=true"},
+		{dsn: "unknown:///app?whatever=1"},
+		{dsn: "unix:///tmp/app.log?maxsize=10XB&rotate_mod=time&lenient=true"},
+		{dsn: "unix:///tmp/app.log?maxsize=&rotate_mode=&compress=&level=&async_flush_interval="},
+		{dsn: "unix:///tmp/app.log?maxsize=&rotate_mode=&lenient="},
+		{
+			dsn:  "unix:///tmp/app.log?rotate_mod=",
+			errs: []string{`dsn: invalid key "rotate_mod"="" of scheme "unix": unknown key`},
+		},
+		{
+			dsn:  "unix:///tmp/app.log?maxsize=10XB",
+			errs: []string{`dsn: invalid key "maxsize"="10XB" of scheme "unix": invalid size: unknown size unit "XB"`},
+		},
+		{
+			dsn:  "unix:///tmp/app.log?rotate_mod=time",
+			errs: []string{`dsn: invalid key "rotate_mod"="time" of scheme "unix": unknown key`},
+		},
+		{
+			dsn:  "unix:///tmp/app.log?rotate_mode=blaa",
+			errs: []string{`dsn: invalid key "rotate_mode"="blaa" of scheme "unix": invalid enum: want one of size, time`},
+		},
+		{
+			dsn:  "unix:///tmp/app.log?rotate_mode=time&maxbackups=3&maxage=7",
+			errs: []string{`dsn: invalid key "maxbackups"="3" of scheme "unix": conflict with maxage under rotate_mode=time`},
+		},
+		{
+			dsn: "unix:///tmp/app.log?rotate_time=7&compress=yes",
+			errs: []string{
+				`dsn: invalid key "compress"="yes" of scheme "unix": invalid bool: strconv.ParseBool: parsing "yes": invalid syntax`,
+				`dsn: invalid key "rotate_time"="7" of scheme "unix": invalid duration: missing unit in 7`,
+				`dsn: invalid key "rotate_time"="7" of scheme "unix": only available under rotate_mode=time`,
+			},
+		},
+		{
+			dsn:  "syslog://127.0.0.1:514?rsyslog_severity=verbose",
+			errs: []string{`dsn: invalid key "rsyslog_severity"="verbose" of scheme "syslog": invalid severity: unknown severity`},
+		},
+	}
+
+	for i, c := range cases {
+		d, err := NewDSN(c.dsn)
+		require.Nil(t, err, "case %d", i)
+
+		err = Validate(d)
+		if len(c.errs) == 0 {
+			require.Nil(t, err, "case %d", i)
+			continue
+		}
+
+		errs := multierr.Errors(err)
+		require.Equal(t, len(c.errs), len(errs), "case %d: %v", i, err)
+		for j := range errs {
+			require.IsType(t, &KeyError{}, errs[j], "case %d", i)
+			require.Equal(t, c.errs[j], errs[j].Error(), "case %d", i)
+		}
+	}
+}
+
+func TestGetQueryOrDefault(t *testing.T) {
+	d, err := NewDSN("unix:///tmp/app.log?maxsize=1024")
+	require.Nil(t, err)
+	require.Equal(t, "1024", d.GetQueryOrDefault(MaxSizeKey))
+	require.Equal(t, "size", d.GetQueryOrDefault(RotateMode))
+	require.Equal(t, "", d.GetQueryOrDefault("unknown"))
+}
+
+func TestValidateSecretKey(t *testing.T) {
+	d, err := NewDSN("syslog://127.0.0.1:514?api_key=abc&password=p&rsyslog_severity=err")
+	require.Nil(t, err)
+	require.Nil(t, Validate(d))
+
+	d, err = NewDSN("syslog://127.0.0.1:514?api_key=abc&rsyslog_severity=verbose")
+	require.Nil(t, err)
+	require.Len(t, multierr.Errors(Validate(d)), 1)
+}
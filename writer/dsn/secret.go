@@ -0,0 +1,190 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package dsn
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// SecretFilePrefix references the secret stored in the file e.g. "token=file:/etc/secrets/token",
+	// the value is replaced by the content of the file without the trailing newlines. It's only
+	// resolved for the secret keys (see IsSecretKey), the other values are kept as they are.
+	SecretFilePrefix = "file:"
+
+	// RedactedValue replaces the secrets in DSN.String.
+	RedactedValue = "xxxxx"
+)
+
+// secretKeySuffixes are the suffixes of the query keys whose values are secrets.
+var secretKeySuffixes = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"credential",
+	"_key", // e.g. tls_key, api_key
+}
+
+// IsSecretKey reports whether the value of the query key is a secret.
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeySuffixes {
+		if strings.HasSuffix(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Interpolate expands ${VAR} and ${VAR:-default} in s with the environment variables.
+// The default is used if VAR is unset or empty, and "$$" is the escaped "$" only if s refers
+// to a variable, thus the string without "${" (e.g. a password with "$$") is kept as it is.
+func Interpolate(s string) (string, error) {
+	return interpolate(s, os.LookupEnv, false)
+}
+
+// interpolate expands the variables of s, the values of variables in the query are escaped
+// if escapeQuery thus the metacharacters e.g. "&" and "=" of secrets cannot split the value.
+func interpolate(s string, lookup func(string) (string, bool), escapeQuery bool) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var (
+		b     strings.Builder
+		query bool
+	)
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '$' || i+1 == len(s) {
+			switch c {
+			case '?':
+				query = true
+			case '#':
+				query = false
+			}
+			b.WriteByte(c)
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("dsn: unterminated variable reference in %q", s)
+			}
+			expr := s[i+2 : i+2+end]
+			name, def, hasDefault := expr, "", false
+			if j := strings.Index(expr, ":-"); j >= 0 {
+				name, def, hasDefault = expr[:j], expr[j+2:], true
+			}
+			if name == "" {
+				return "", fmt.Errorf("dsn: empty variable name in %q", s)
+			}
+
+			v, ok := lookup(name)
+			if (!ok || v == "") && hasDefault {
+				// the default is written in DSN thus it's escaped already
+				v = def
+			} else if query && escapeQuery {
+				v = url.QueryEscape(v)
+			}
+			b.WriteString(v)
+			i += 2 + end
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// resolveSecrets replaces the file references of the secret keys with the content of files,
+// it returns the redacted values of the secret keys.
+func resolveSecrets(u *url.URL) (map[string]string, error) {
+	if u.RawQuery == "" {
+		return nil, nil
+	}
+
+	var (
+		secrets  map[string]string
+		resolved bool
+	)
+
+	q := u.Query()
+	for k, vs := range q {
+		if !IsSecretKey(k) {
+			continue
+		}
+
+		redacted := ""
+		for i, v := range vs {
+			if !strings.HasPrefix(v, SecretFilePrefix) {
+				continue
+			}
+
+			b, err := ioutil.ReadFile(strings.TrimPrefix(v, SecretFilePrefix))
+			if err != nil {
+				return nil, fmt.Errorf("dsn: failed to read secret of key %q: %v", k, err)
+			}
+			vs[i] = strings.TrimRight(string(b), "\r\n")
+			redacted = v
+			resolved = true
+		}
+
+		if redacted == "" {
+			redacted = RedactedValue
+		}
+
+		if secrets == nil {
+			secrets = make(map[string]string)
+		}
+		secrets[k] = redacted
+	}
+
+	if resolved {
+		u.RawQuery = q.Encode()
+	}
+
+	return secrets, nil
+}
+
+// redact returns the copy of u without secrets.
+func redact(u *url.URL, secrets map[string]string) *url.URL {
+	ru := *u
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			ru.User = url.UserPassword(u.User.Username(), RedactedValue)
+		}
+	}
+
+	if len(secrets) > 0 {
+		q := u.Query()
+		for k, v := range secrets {
+			q[k] = []string{v}
+		}
+		ru.RawQuery = q.Encode()
+	}
+
+	return &ru
+}
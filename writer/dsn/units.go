@@ -0,0 +1,195 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package dsn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nolint
+const (
+	B   int64 = 1
+	KB  int64 = 1000
+	MB  int64 = 1000 * KB
+	GB  int64 = 1000 * MB
+	TB  int64 = 1000 * GB
+	KiB int64 = 1 << 10
+	MiB int64 = 1 << 20
+	GiB int64 = 1 << 30
+	TiB int64 = 1 << 40
+
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
+var sizeUnits = map[string]int64{
+	"b":   B,
+	"k":   KiB,
+	"kb":  KB,
+	"kib": KiB,
+	"m":   MiB,
+	"mb":  MB,
+	"mib": MiB,
+	"g":   GiB,
+	"gb":  GB,
+	"gib": GiB,
+	"t":   TiB,
+	"tb":  TB,
+	"tib": TiB,
+}
+
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  Day,
+	"w":  Week,
+}
+
+var errEmptyValue = errors.New("empty value")
+
+// splitNumber splits s into the leading decimal number and the rest.
+func splitNumber(s string) (float64, string, error) {
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	if i == 0 {
+		return 0, "", fmt.Errorf("missing number in %q", s)
+	}
+
+	f, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid number %q", s[:i])
+	}
+
+	return f, s[i:], nil
+}
+
+// ParseBytes parses the size like "512MiB", "1GB" or "1.5g" (K, M, G and T are binary units).
+// The bare number is multiplied by unit for compatibility, e.g. ParseBytes("10", MiB).
+func ParseBytes(s string, unit int64) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errEmptyValue
+	}
+
+	f, rest, err := splitNumber(s)
+	if err != nil {
+		return 0, err
+	}
+
+	u := unit
+	if rest != "" {
+		var ok bool
+		u, ok = sizeUnits[strings.ToLower(strings.TrimSpace(rest))]
+		if !ok {
+			return 0, fmt.Errorf("unknown size unit %q", rest)
+		}
+	}
+
+	if f*float64(u) > math.MaxInt64 {
+		return 0, fmt.Errorf("size %q overflows", s)
+	}
+
+	return int64(math.Ceil(f * float64(u))), nil
+}
+
+// ParseDurationUnit parses the duration like "90s", "7d", "1w" or "1d12h30m".
+// The bare number is multiplied by unit for compatibility, e.g. ParseDurationUnit("7", Day),
+// only "0" is allowed as the bare number if unit is 0.
+func ParseDurationUnit(s string, unit time.Duration) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errEmptyValue
+	}
+
+	neg := false
+	if s[0] == '-' || s[0] == '+' {
+		neg = s[0] == '-'
+		s = s[1:]
+		if s == "" {
+			return 0, errors.New("missing number")
+		}
+	}
+
+	var d float64
+	for first := true; s != ""; first = false {
+		f, rest, err := splitNumber(s)
+		if err != nil {
+			return 0, err
+		}
+
+		i := 0
+		for i < len(rest) && !(rest[i] >= '0' && rest[i] <= '9' || rest[i] == '.') {
+			i++
+		}
+		name := rest[:i]
+		s = rest[i:]
+
+		u := unit
+		if name == "" {
+			if !first {
+				return 0, fmt.Errorf("missing unit after %v", f)
+			}
+			if unit == 0 && f != 0 {
+				return 0, fmt.Errorf("missing unit in %v", f)
+			}
+		} else {
+			var ok bool
+			u, ok = durationUnits[strings.ToLower(name)]
+			if !ok {
+				return 0, fmt.Errorf("unknown duration unit %q", name)
+			}
+		}
+
+		d += f * float64(u)
+		if d > math.MaxInt64 {
+			return 0, errors.New("duration overflows")
+		}
+	}
+
+	if neg {
+		d = -d
+	}
+
+	return time.Duration(d), nil
+}
+
+// ParseSize returns the def if failed to parse the size.
+func ParseSize(s string, unit int64, def int64) int64 {
+	n, err := ParseBytes(s, unit)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// ParseDays returns the def if failed to parse the duration, the bare number is in days.
+func ParseDays(s string, def time.Duration) time.Duration {
+	d, err := ParseDurationUnit(s, Day)
+	if err != nil {
+		return def
+	}
+	return d
+}
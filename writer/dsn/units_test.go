@@ -0,0 +1,88 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package dsn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBytes(t *testing.T) {
+	cases := []struct {
+		s    string
+		unit int64
+		n    int64
+		ok   bool
+	}{
+		{"10", MiB, 10 * MiB, true},
+		{"512MiB", MiB, 512 * MiB, true},
+		{"1GB", MiB, GB, true},
+		{"1gib", B, GiB, true},
+		{"1.5k", B, 1536, true},
+		{"100 b", MiB, 100, true},
+		{"0", MiB, 0, true},
+		{"", MiB, 0, false},
+		{"MB", MiB, 0, false},
+		{"10XB", MiB, 0, false},
+		{"1.2.3MB", MiB, 0, false},
+		{"99999999TB", B, 0, false},
+	}
+
+	for i, c := range cases {
+		n, err := ParseBytes(c.s, c.unit)
+		if c.ok {
+			require.Nil(t, err, "case %d", i)
+			require.Equal(t, c.n, n, "case %d", i)
+		} else {
+			require.NotNil(t, err, "case %d", i)
+		}
+	}
+}
+
+func TestParseDurationUnit(t *testing.T) {
+	cases := []struct {
+		s    string
+		unit time.Duration
+		d    time.Duration
+		ok   bool
+	}{
+		{"7", Day, 7 * Day, true},
+		{"7d", Day, 7 * Day, true},
+		{"1w", 0, Week, true},
+		{"90s", 0, 90 * time.Second, true},
+		{"1d12h30m", 0, 36*time.Hour + 30*time.Minute, true},
+		{"1.5h", 0, 90 * time.Minute, true},
+		{"100ms", 0, 100 * time.Millisecond, true},
+		{"-1h", 0, -time.Hour, true},
+		{"0", 0, 0, true},
+		{"7", 0, 0, false},
+		{"1h30", 0, 0, false},
+		{"5y", 0, 0, false},
+		{"h", 0, 0, false},
+		{"-", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for i, c := range cases {
+		d, err := ParseDurationUnit(c.s, c.unit)
+		if c.ok {
+			require.Nil(t, err, "case %d", i)
+			require.Equal(t, c.d, d, "case %d", i)
+		} else {
+			require.NotNil(t, err, "case %d", i)
+		}
+	}
+}
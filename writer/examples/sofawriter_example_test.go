@@ -21,7 +21,7 @@ import (
 )
 
 func ExampleSofaWriter() {
-	w, err := sofawriter.NewFromDSNString("unix:///dev/stderr?async=true&batch=32")
+	w, err := sofawriter.NewFromDSNString("unix:///dev/stderr?async=true&async_batch=32")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,132 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+// Package framer implements the LineFramer which frames a record before writing it.
+package framer
+
+import (
+	"encoding/binary"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sofastack/sofa-common-go/syncpool/bytespool"
+)
+
+var (
+	hostname string
+	pid      = strconv.Itoa(os.Getpid())
+)
+
+func init() {
+	hostname, _ = os.Hostname()
+}
+
+// LineFramer frames the record p.
+type LineFramer interface {
+	// Frame appends the framed p to dst and returns the extended buffer.
+	Frame(dst []byte, p []byte, now time.Time) []byte
+}
+
+// LineFramerFunc wraps the function as LineFramer.
+type LineFramerFunc func(dst []byte, p []byte, now time.Time) []byte
+
+// Frame implements LineFramer.
+func (f LineFramerFunc) Frame(dst []byte, p []byte, now time.Time) []byte {
+	return f(dst, p, now)
+}
+
+// Nop returns a framer which does nothing.
+func Nop() LineFramer {
+	return LineFramerFunc(func(dst []byte, p []byte, now time.Time) []byte {
+		return append(dst, p...)
+	})
+}
+
+// TimePrefix returns a framer prepends the time in layout and a space.
+func TimePrefix(layout string) LineFramer {
+	return LineFramerFunc(func(dst []byte, p []byte, now time.Time) []byte {
+		dst = now.AppendFormat(dst, layout)
+		dst = append(dst, ' ')
+		return append(dst, p...)
+	})
+}
+
+// StringPrefix returns a framer prepends the s and a space.
+func StringPrefix(s string) LineFramer {
+	return LineFramerFunc(func(dst []byte, p []byte, now time.Time) []byte {
+		dst = append(dst, s...)
+		dst = append(dst, ' ')
+		return append(dst, p...)
+	})
+}
+
+// HostnamePrefix returns a framer prepends the hostname and a space.
+func HostnamePrefix() LineFramer { return StringPrefix(hostname) }
+
+// PIDPrefix returns a framer prepends the pid and a space.
+func PIDPrefix() LineFramer { return StringPrefix(pid) }
+
+// Newline returns a framer makes sure the record ends with exactly one '\n'.
+func Newline() LineFramer {
+	return LineFramerFunc(func(dst []byte, p []byte, now time.Time) []byte {
+		for len(p) > 0 && (p[len(p)-1] == '\n' || p[len(p)-1] == '\r') {
+			p = p[:len(p)-1]
+		}
+		dst = append(dst, p...)
+		return append(dst, '\n')
+	})
+}
+
+// LengthPrefix returns a framer prepends the length of record in 4 bytes big endian.
+func LengthPrefix() LineFramer {
+	return LineFramerFunc(func(dst []byte, p []byte, now time.Time) []byte {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(p)))
+		dst = append(dst, l[:]...)
+		return append(dst, p...)
+	})
+}
+
+type chain []LineFramer
+
+// Chain chains the framers into one, the first framer is the outermost one.
+// e.g. Chain(TimePrefix(layout), HostnamePrefix(), Newline()) frames the record as
+// "<time> <hostname> <record>\n".
+func Chain(framers ...LineFramer) LineFramer {
+	switch len(framers) {
+	case 0:
+		return Nop()
+	case 1:
+		return framers[0]
+	default:
+		return chain(framers)
+	}
+}
+
+func (c chain) Frame(dst []byte, p []byte, now time.Time) []byte {
+	a := bytespool.AcquireBytes()
+	b := bytespool.AcquireBytes()
+
+	*a = append((*a)[:0], p...)
+	for i := len(c) - 1; i > 0; i-- {
+		*b = c[i].Frame((*b)[:0], *a, now)
+		a, b = b, a
+	}
+	dst = c[0].Frame(dst, *a, now)
+
+	bytespool.ReleaseBytes(a)
+	bytespool.ReleaseBytes(b)
+
+	return dst
+}
@@ -0,0 +1,55 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package framer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFramer(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		f      LineFramer
+		p      string
+		expect string
+	}{
+		{Nop(), "hello", "hello"},
+		{TimePrefix("2006-01-02"), "hello", "2020-01-02 hello"},
+		{HostnamePrefix(), "hello", hostname + " hello"},
+		{PIDPrefix(), "hello", pid + " hello"},
+		{Newline(), "hello", "hello\n"},
+		{Newline(), "hello\n", "hello\n"},
+		{Newline(), "hello\r\n\n", "hello\n"},
+		{LengthPrefix(), "hello", "\x00\x00\x00\x05hello"},
+		{Chain(), "hello", "hello"},
+		{
+			Chain(TimePrefix("2006-01-02"), PIDPrefix(), Newline()),
+			"hello\n",
+			"2020-01-02 " + pid + " hello\n",
+		},
+		{
+			Chain(LengthPrefix(), Newline()),
+			"hello",
+			"\x00\x00\x00\x06hello\n",
+		},
+	}
+
+	for i, c := range cases {
+		require.Equal(t, c.expect, string(c.f.Frame(nil, []byte(c.p), now)), "case %d", i)
+		require.Equal(t, "x"+c.expect, string(c.f.Frame([]byte("x"), []byte(c.p), now)), "case %d", i)
+	}
+}
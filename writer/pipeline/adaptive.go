@@ -0,0 +1,111 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"math"
+	"time"
+)
+
+// AdaptiveFlush bounds the flush delay and batch size which are tuned by the observed
+// arrival rate and write latency. The zero MaxDelay defaults to 10ms and the zero batch
+// bounds default to [1, capacity of queue].
+type AdaptiveFlush struct {
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	MinBatch int
+	MaxBatch int
+}
+
+func (a *AdaptiveFlush) polyfill(capacity int) {
+	if a.MaxDelay <= 0 {
+		a.MaxDelay = 10 * time.Millisecond
+	}
+	if a.MinDelay > a.MaxDelay {
+		a.MinDelay = a.MaxDelay
+	}
+
+	if a.MaxBatch <= 0 || a.MaxBatch > capacity {
+		a.MaxBatch = capacity
+	}
+	if a.MinBatch <= 0 {
+		a.MinBatch = 1
+	}
+	if a.MinBatch > a.MaxBatch {
+		a.MinBatch = a.MaxBatch
+	}
+}
+
+// adaptiveAlpha is the weight of the new sample of EWMA.
+const adaptiveAlpha = 0.25
+
+// adaptive tunes the flush delay and batch size, it's only accessed by the write loop.
+//
+// Under low load (less than one record arrives during a write) waiting only adds latency,
+// thus it flushes after MinDelay. Under high load it waits about one write latency to batch
+// the records arriving meanwhile, and the batch size follows the records arriving during
+// the delay and the write.
+type adaptive struct {
+	bounds  AdaptiveFlush
+	last    time.Time
+	rate    float64 // records per second
+	latency float64 // seconds per write
+	delay   time.Duration
+	batch   int
+}
+
+func newAdaptive(bounds AdaptiveFlush) *adaptive {
+	return &adaptive{
+		bounds: bounds,
+		delay:  bounds.MinDelay,
+		batch:  bounds.MaxBatch,
+	}
+}
+
+// observe records the write of n records which started at start and took d.
+func (a *adaptive) observe(n int, start time.Time, d time.Duration) {
+	end := start.Add(d)
+	if !a.last.IsZero() {
+		if window := end.Sub(a.last).Seconds(); window > 0 {
+			a.rate = ewma(a.rate, float64(n)/window)
+		}
+	}
+	a.last = end
+	a.latency = ewma(a.latency, d.Seconds())
+
+	if a.rate*a.latency < 1 {
+		a.delay = a.bounds.MinDelay
+	} else {
+		a.delay = time.Duration(a.latency * float64(time.Second))
+		if a.delay < a.bounds.MinDelay {
+			a.delay = a.bounds.MinDelay
+		} else if a.delay > a.bounds.MaxDelay {
+			a.delay = a.bounds.MaxDelay
+		}
+	}
+
+	a.batch = int(math.Ceil(a.rate * (a.delay.Seconds() + a.latency)))
+	if a.batch < a.bounds.MinBatch {
+		a.batch = a.bounds.MinBatch
+	} else if a.batch > a.bounds.MaxBatch {
+		a.batch = a.bounds.MaxBatch
+	}
+}
+
+func ewma(old, sample float64) float64 {
+	if old == 0 {
+		return sample
+	}
+	return old + adaptiveAlpha*(sample-old)
+}
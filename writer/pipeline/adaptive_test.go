@@ -0,0 +1,84 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptive(t *testing.T) {
+	bounds := AdaptiveFlush{MinDelay: 100 * time.Microsecond, MaxDelay: 5 * time.Millisecond, MinBatch: 2}
+	bounds.polyfill(64)
+	require.Equal(t, 64, bounds.MaxBatch)
+
+	a := newAdaptive(bounds)
+	require.Equal(t, bounds.MinDelay, a.delay)
+	require.Equal(t, 64, a.batch)
+
+	// low load: 1 record every 10ms and the write takes 100us
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		now = now.Add(10 * time.Millisecond)
+		a.observe(1, now, 100*time.Microsecond)
+	}
+	require.Equal(t, bounds.MinDelay, a.delay)
+	require.Equal(t, bounds.MinBatch, a.batch)
+
+	// high load: 100 records every 1ms and the write takes 1ms
+	for i := 0; i < 50; i++ {
+		now = now.Add(time.Millisecond)
+		a.observe(100, now, time.Millisecond)
+	}
+	require.InDelta(t, float64(time.Millisecond), float64(a.delay), float64(100*time.Microsecond))
+	require.Equal(t, 64, a.batch)
+
+	// the slow write is bounded by MaxDelay
+	for i := 0; i < 50; i++ {
+		now = now.Add(20 * time.Millisecond)
+		a.observe(10, now, 20*time.Millisecond)
+	}
+	require.Equal(t, bounds.MaxDelay, a.delay)
+	require.True(t, a.batch >= bounds.MinBatch && a.batch <= bounds.MaxBatch)
+}
+
+func TestPipelineAdaptiveFlush(t *testing.T) {
+	for _, m := range []Mode{FlushMode, WritevMode} {
+		mw := &buffer{}
+		p, err := New(mw, NewOption().
+			SetMode(m).
+			AllowBlockForever().
+			SetAdaptiveFlush(AdaptiveFlush{MaxDelay: time.Millisecond, MaxBatch: 16}))
+		require.Nil(t, err)
+
+		metrics := p.GetMetrics().(*CounterMetrics)
+		require.Equal(t, int64(16), metrics.GetBatchSize())
+
+		for i := 0; i < 1000; i++ {
+			_, err = p.Write([]byte("0123456789"))
+			require.Nil(t, err)
+		}
+
+		require.Eventually(t, func() bool {
+			return metrics.GetBytes() == 10000
+		}, time.Second, time.Millisecond)
+		require.Equal(t, strings.Repeat("0123456789", 1000), mw.String())
+		require.True(t, metrics.GetFlushDelay() <= time.Millisecond)
+		require.True(t, metrics.GetBatchSize() >= 1 && metrics.GetBatchSize() <= 16)
+		require.Nil(t, p.Close())
+	}
+}
@@ -0,0 +1,215 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// inflight is the record added to context until flushed.
+type inflight struct {
+	size int
+	b    *[]byte // nil if it was copied into buffer
+	done Callback
+	at   int64
+}
+
+// context is the state of the write loop.
+type context struct {
+	option  *Option
+	writer  io.Writer
+	conn    net.Conn
+	writev  bool
+	limit   int // the max records of batch, 0 is unlimited
+	buffer  []byte
+	iovs    [][]byte
+	records []inflight
+}
+
+func (ctx *context) reset() {
+	if len(ctx.records) > 0 {
+		ctx.complete(0, ctx.option.errors.Closed)
+	}
+	ctx.option = nil
+	ctx.writer = nil
+	ctx.conn = nil
+	ctx.writev = false
+	ctx.limit = 0
+	ctx.buffer = ctx.buffer[:0]
+	ctx.iovs = ctx.iovs[:0]
+}
+
+// add appends the record to be flushed and reports whether it can accept more, the buffer
+// is kept until flushed without copying under writev.
+func (ctx *context) add(r record) bool {
+	if ctx.writev {
+		ctx.iovs = append(ctx.iovs, *r.b)
+		ctx.records = append(ctx.records, inflight{size: len(*r.b), b: r.b, done: r.done, at: r.at})
+	} else {
+		ctx.buffer = append(ctx.buffer, *r.b...)
+		ctx.records = append(ctx.records, inflight{size: len(*r.b), done: r.done, at: r.at})
+		releaseBuffer(r.b)
+	}
+	return !ctx.full()
+}
+
+// full reports whether the records should be flushed before adding more.
+func (ctx *context) full() bool {
+	return ctx.limit > 0 && len(ctx.records) >= ctx.limit
+}
+
+func (ctx *context) setDeadline() error {
+	if ctx.option.timeout != 0 && ctx.conn != nil { // can set timeout
+		return ctx.conn.SetWriteDeadline(time.Now().Add(ctx.option.timeout))
+	}
+	return nil
+}
+
+// Flush writes the pending records, it returns the bytes written and the number of
+// records which were delivered entirely. The records are completed and released.
+func (ctx *context) Flush() (int, int, error) {
+	if len(ctx.records) == 0 {
+		return 0, 0, nil
+	}
+
+	var (
+		n   int64
+		err error
+	)
+	if err = ctx.setDeadline(); err == nil {
+		if ctx.writev {
+			n, err = ctx.flushv()
+		} else {
+			var nw int
+			nw, err = writeFull(ctx.writer, ctx.buffer)
+			n = int64(nw)
+		}
+	}
+
+	return int(n), ctx.complete(n, err), err
+}
+
+// flushv writes the buffers by writev if the writer is net.Conn, it resumes from the
+// short write thus the following buffers are not written before the rest of it.
+func (ctx *context) flushv() (int64, error) {
+	if len(ctx.iovs) == 1 { // one iov: use raw write
+		n, err := writeFull(ctx.writer, ctx.iovs[0])
+		return int64(n), err
+	}
+
+	var (
+		bufs  = net.Buffers(ctx.iovs)
+		total int64
+	)
+	for len(bufs) > 0 {
+		var (
+			n   int64
+			err error
+		)
+		if ctx.conn != nil {
+			// WriteTo consumes the written bytes of bufs
+			n, err = bufs.WriteTo(ctx.conn)
+		} else {
+			var nw int
+			nw, err = ctx.writer.Write(bufs[0])
+			n = int64(clamp(nw, len(bufs[0])))
+			consume(&bufs, n)
+		}
+
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n == 0 && len(bufs) > 0 {
+			return total, io.ErrShortWrite
+		}
+	}
+
+	return total, nil
+}
+
+// complete completes the records by the n bytes written: the records written entirely
+// were delivered and the others failed because of err. It returns the number of delivered.
+func (ctx *context) complete(n int64, err error) int {
+	delivered := 0
+	for i := range ctx.records {
+		r := &ctx.records[i]
+		if err == nil || int64(r.size) <= n {
+			n -= int64(r.size)
+			delivered++
+			if r.done != nil {
+				r.done(nil)
+			}
+		} else {
+			n = 0
+			if r.done != nil {
+				r.done(err)
+			}
+		}
+
+		if r.b != nil {
+			releaseBuffer(r.b)
+		}
+		*r = inflight{}
+	}
+
+	ctx.records = ctx.records[:0]
+	ctx.iovs = ctx.iovs[:0]
+	ctx.buffer = ctx.buffer[:0]
+	return delivered
+}
+
+// writeFull writes b and resumes from the short write.
+func writeFull(w io.Writer, b []byte) (int, error) {
+	total := 0
+	for total < len(b) {
+		n, err := w.Write(b[total:])
+		total += clamp(n, len(b)-total)
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, io.ErrShortWrite
+		}
+	}
+	return total, nil
+}
+
+// clamp returns the n bytes reported by the writer of size bytes within [0, size], the writer
+// reporting more than it was given (e.g. the framed length) must not skip the following buffers.
+func clamp(n, size int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > size {
+		return size
+	}
+	return n
+}
+
+// consume drops the n bytes from the head of v.
+func consume(v *net.Buffers, n int64) {
+	for len(*v) > 0 {
+		ln0 := int64(len((*v)[0]))
+		if ln0 > n {
+			(*v)[0] = (*v)[0][n:]
+			return
+		}
+		n -= ln0
+		(*v)[0] = nil
+		*v = (*v)[1:]
+	}
+}
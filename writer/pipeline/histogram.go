@@ -0,0 +1,226 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// histogramSubBits splits each power of two into 8 buckets, thus the relative
+	// error of quantile is about 12.5%.
+	histogramSubBits    = 3
+	histogramSubBuckets = 1 << histogramSubBits
+	histogramBuckets    = (64 - histogramSubBits) * histogramSubBuckets
+)
+
+// Histogram is the lock-free histogram of non-negative values with HDR-style buckets:
+// the values less than 8 are exact and the others are in log-linear buckets.
+// The zero value is ready to use.
+type Histogram struct {
+	counts [histogramBuckets]int64
+	count  int64
+	sum    int64
+	min    int64 // min+1, 0 indicates no value
+	max    int64
+}
+
+func histogramIndex(v int64) int {
+	if v < histogramSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - 1 - histogramSubBits
+	sub := int(v>>uint(shift)) & (histogramSubBuckets - 1)
+	return (shift+1)*histogramSubBuckets + sub
+}
+
+// histogramUpper returns the max value of bucket i.
+func histogramUpper(i int) int64 {
+	if i < histogramSubBuckets {
+		return int64(i)
+	}
+	shift := uint(i/histogramSubBuckets - 1)
+	sub := int64(i % histogramSubBuckets)
+	lower := (sub + histogramSubBuckets) << shift
+	return lower + (1 << shift) - 1
+}
+
+// Record records the value, the negative value is recorded as 0.
+func (h *Histogram) Record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+
+	atomic.AddInt64(&h.counts[histogramIndex(v)], 1)
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, v)
+
+	for {
+		old := atomic.LoadInt64(&h.min)
+		if (old != 0 && old-1 <= v) || atomic.CompareAndSwapInt64(&h.min, old, v+1) {
+			break
+		}
+	}
+
+	for {
+		old := atomic.LoadInt64(&h.max)
+		if old >= v || atomic.CompareAndSwapInt64(&h.max, old, v) {
+			break
+		}
+	}
+}
+
+// Snapshot returns the snapshot of histogram. The concurrent records may be partially
+// seen by the snapshot because the buckets are read one by one.
+func (h *Histogram) Snapshot() *HistogramSnapshot {
+	s := &HistogramSnapshot{
+		Count: atomic.LoadInt64(&h.count),
+		Sum:   atomic.LoadInt64(&h.sum),
+		Max:   atomic.LoadInt64(&h.max),
+	}
+	if min := atomic.LoadInt64(&h.min); min > 0 {
+		s.Min = min - 1
+	}
+	for i := range h.counts {
+		s.counts[i] = atomic.LoadInt64(&h.counts[i])
+	}
+	return s
+}
+
+// Reset clears the histogram, the concurrent records may be partially cleared.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreInt64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.count, 0)
+	atomic.StoreInt64(&h.sum, 0)
+	atomic.StoreInt64(&h.min, 0)
+	atomic.StoreInt64(&h.max, 0)
+}
+
+// HistogramSnapshot is the snapshot of Histogram.
+type HistogramSnapshot struct {
+	Count  int64
+	Sum    int64
+	Min    int64
+	Max    int64
+	counts [histogramBuckets]int64
+}
+
+// Mean returns the mean of values.
+func (s *HistogramSnapshot) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Sum) / float64(s.Count)
+}
+
+// Quantile returns the upper bound of the bucket containing the q-quantile (0 <= q <= 1).
+func (s *HistogramSnapshot) Quantile(q float64) int64 {
+	var total int64
+	for i := range s.counts {
+		total += s.counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := int64(math.Ceil(q * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var n int64
+	for i := range s.counts {
+		n += s.counts[i]
+		if n >= rank {
+			if v := histogramUpper(i); v < s.Max {
+				return v
+			}
+			return s.Max
+		}
+	}
+	return s.Max
+}
+
+func (s *HistogramSnapshot) MarshalJSON() ([]byte, error) {
+	type Snapshot struct {
+		Count int64   `json:"count"`
+		Sum   int64   `json:"sum"`
+		Min   int64   `json:"min"`
+		Max   int64   `json:"max"`
+		Mean  float64 `json:"mean"`
+		P50   int64   `json:"p50"`
+		P90   int64   `json:"p90"`
+		P99   int64   `json:"p99"`
+		P999  int64   `json:"p999"`
+	}
+
+	return jsoniter.Marshal(&Snapshot{
+		Count: s.Count,
+		Sum:   s.Sum,
+		Min:   s.Min,
+		Max:   s.Max,
+		Mean:  s.Mean(),
+		P50:   s.Quantile(0.5),
+		P90:   s.Quantile(0.9),
+		P99:   s.Quantile(0.99),
+		P999:  s.Quantile(0.999),
+	})
+}
+
+// Histograms are the histograms of pipeline.
+type Histograms struct {
+	// QueueLatency is the nanoseconds from the record was enqueued to it was flushed.
+	QueueLatency Histogram
+	// WriteDuration is the nanoseconds of the underlying write of each flush.
+	WriteDuration Histogram
+	// RecordsPerFlush is the number of records of each flush.
+	RecordsPerFlush Histogram
+}
+
+// Snapshot returns the snapshot of histograms.
+func (h *Histograms) Snapshot() *HistogramsSnapshot {
+	return &HistogramsSnapshot{
+		QueueLatency:    h.QueueLatency.Snapshot(),
+		WriteDuration:   h.WriteDuration.Snapshot(),
+		RecordsPerFlush: h.RecordsPerFlush.Snapshot(),
+	}
+}
+
+// Reset clears the histograms.
+func (h *Histograms) Reset() {
+	h.QueueLatency.Reset()
+	h.WriteDuration.Reset()
+	h.RecordsPerFlush.Reset()
+}
+
+// HistogramsSnapshot is the snapshot of Histograms.
+type HistogramsSnapshot struct {
+	QueueLatency    *HistogramSnapshot `json:"queue_latency_ns"`
+	WriteDuration   *HistogramSnapshot `json:"write_duration_ns"`
+	RecordsPerFlush *HistogramSnapshot `json:"records_per_flush"`
+}
+
+var epoch = time.Now()
+
+// nanotime returns the monotonic nanoseconds.
+func nanotime() int64 {
+	return int64(time.Since(epoch))
+}
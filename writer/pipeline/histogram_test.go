@@ -0,0 +1,101 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramIndex(t *testing.T) {
+	for i := 0; i < histogramBuckets; i++ {
+		upper := histogramUpper(i)
+		require.Equal(t, i, histogramIndex(upper), "bucket %d", i)
+		if i > 0 {
+			require.Equal(t, i, histogramIndex(histogramUpper(i-1)+1), "bucket %d", i)
+		}
+	}
+	require.Equal(t, histogramBuckets-1, histogramIndex(1<<63-1))
+}
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	s := h.Snapshot()
+	require.Equal(t, int64(0), s.Count)
+	require.Equal(t, int64(0), s.Quantile(0.5))
+	require.Equal(t, float64(0), s.Mean())
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := int64(1); v <= 1000; v++ {
+				h.Record(v)
+			}
+		}()
+	}
+	wg.Wait()
+	h.Record(-1)
+
+	s = h.Snapshot()
+	require.Equal(t, int64(4001), s.Count)
+	require.Equal(t, int64(4*500500), s.Sum)
+	require.Equal(t, int64(0), s.Min)
+	require.Equal(t, int64(1000), s.Max)
+	require.InEpsilon(t, 500, float64(s.Quantile(0.5)), 0.125)
+	require.InEpsilon(t, 990, float64(s.Quantile(0.99)), 0.125)
+	require.Equal(t, int64(1000), s.Quantile(1))
+
+	js, err := s.MarshalJSON()
+	require.Nil(t, err)
+	require.Contains(t, string(js), `"count":4001,"sum":2002000,"min":0,"max":1000`)
+
+	h.Reset()
+	s = h.Snapshot()
+	require.Equal(t, int64(0), s.Count)
+	require.Equal(t, int64(0), s.Max)
+	require.Equal(t, int64(0), s.Quantile(0.5))
+}
+
+func TestPipelineHistograms(t *testing.T) {
+	p, err := New(&buffer{}, NewOption().SetMode(ManualMode).EnableHistograms())
+	require.Nil(t, err)
+	require.NotNil(t, p.GetHistograms())
+
+	for i := 0; i < 3; i++ {
+		_, err = p.Write([]byte("abcd"))
+		require.Nil(t, err)
+	}
+	time.Sleep(time.Millisecond)
+	_, err = p.FlushOnce(0)
+	require.Nil(t, err)
+
+	s := p.GetHistograms().Snapshot()
+	require.Equal(t, int64(3), s.QueueLatency.Count)
+	require.True(t, s.QueueLatency.Min >= int64(time.Millisecond))
+	require.Equal(t, int64(1), s.WriteDuration.Count)
+	require.Equal(t, int64(1), s.RecordsPerFlush.Count)
+	require.Equal(t, int64(3), s.RecordsPerFlush.Max)
+
+	p.GetHistograms().Reset()
+	require.Equal(t, int64(0), p.GetHistograms().Snapshot().QueueLatency.Count)
+
+	p, err = New(&buffer{}, nil)
+	require.Nil(t, err)
+	require.Nil(t, p.GetHistograms())
+}
@@ -0,0 +1,169 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// FlushOnce pops at most max pending records (all of the available records if max <= 0)
+// and flushes them without waiting for more, it returns the number of delivered records
+// which includes the records delivered before the failure if it returns an error.
+// It drives the ManualMode pipeline without the write loop, e.g. at the end of each
+// iteration of the event loop.
+func (p *Pipeline) FlushOnce(max int) (int, error) {
+	return p.step(max, time.Time{})
+}
+
+// FlushUntil flushes the pending records batch by batch until there is no record or
+// the deadline passed, it returns the number of delivered records like FlushOnce.
+func (p *Pipeline) FlushUntil(deadline time.Time) (int, error) {
+	return p.step(0, deadline)
+}
+
+// step flushes the pending records like the write loop but returns once the queue is empty.
+func (p *Pipeline) step(max int, deadline time.Time) (int, error) {
+	if !atomic.CompareAndSwapUint32(&p.running, 0, 1) {
+		return 0, ErrRunning
+	}
+	defer p.release()
+
+	if err := p.werr.Load(); err != nil {
+		return 0, err
+	}
+
+	ctx := p.acquireContext(p.option.mode != FlushMode)
+	defer releaseContext(ctx)
+
+	total := 0
+	for {
+		var (
+			left = max - total
+			k    = 0
+		)
+		n, closed := p.queue.poll(func(r record) bool {
+			k++
+			return ctx.add(r) && (max <= 0 || k < left)
+		})
+
+		if n > 0 {
+			delivered, err := p.flush(ctx)
+			total += delivered
+			if err != nil {
+				return total, p.exit(err)
+			}
+		}
+
+		if closed {
+			return total, p.exit(p.option.errors.ActivelyClosed)
+		}
+
+		if n == 0 || (max > 0 && total >= max) ||
+			(!deadline.IsZero() && !time.Now().Before(deadline)) {
+			return total, nil
+		}
+	}
+}
+
+// Iterator pops the pending records of pipeline, see Pipeline.Pending.
+type Iterator struct {
+	p    *Pipeline
+	b    *[]byte
+	err  error
+	done bool
+}
+
+// Pending returns the iterator which pops the pending records thus the caller writes
+// them by itself, e.g.
+//
+//	it := p.Pending()
+//	for it.Next() {
+//		out = append(out, it.Bytes()...)
+//	}
+//	err := it.Close()
+//
+// The records are counted as flushed and completed once popped. The write loop and the other
+// iterators cannot run until the iterator is closed.
+func (p *Pipeline) Pending() *Iterator {
+	it := &Iterator{p: p}
+	if !atomic.CompareAndSwapUint32(&p.running, 0, 1) {
+		it.err = ErrRunning
+		it.done = true
+		return it
+	}
+
+	it.err = p.werr.Load()
+	return it
+}
+
+// Next pops the next record, it returns false if there is no record or failed.
+func (it *Iterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	it.release()
+
+	n, closed := it.p.queue.poll(func(r record) bool {
+		it.b = r.b
+		if it.p.hist != nil {
+			it.p.hist.QueueLatency.Record(nanotime() - r.at)
+		}
+		r.complete(nil)
+		return false
+	})
+	if n > 0 {
+		it.p.metrics.AddPendingRequests(-1)
+		it.p.metrics.AddBytes(int64(len(*it.b)))
+		return true
+	}
+
+	if closed {
+		it.err = it.p.exit(it.p.option.errors.ActivelyClosed)
+	}
+
+	return false
+}
+
+// Bytes returns the current record which is only valid until the next call of Next or Close.
+func (it *Iterator) Bytes() []byte {
+	if it.b == nil {
+		return nil
+	}
+	return *it.b
+}
+
+// Err returns the error which stopped the iteration.
+func (it *Iterator) Err() error { return it.err }
+
+// Close releases the iterator and returns the error which stopped the iteration.
+func (it *Iterator) Close() error {
+	if it.done {
+		return it.err
+	}
+	it.done = true
+
+	it.release()
+	it.p.release()
+
+	return it.err
+}
+
+func (it *Iterator) release() {
+	if it.b != nil {
+		releaseBuffer(it.b)
+		it.b = nil
+	}
+}
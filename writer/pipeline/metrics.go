@@ -0,0 +1,69 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives the counters of pipeline.
+type Metrics interface {
+	// AddRequests adds the number of accepted writes.
+	AddRequests(n int64)
+	// AddPendingRequests adds the number of writes which are not flushed yet.
+	AddPendingRequests(n int64)
+	// GetPendingRequests returns the number of writes which are not flushed yet.
+	GetPendingRequests() int64
+	// AddBytes adds the number of bytes flushed.
+	AddBytes(n int64)
+	// SetFlushDelay sets the flush delay chosen by the adaptive flush.
+	SetFlushDelay(d time.Duration)
+	// SetBatchSize sets the batch size chosen by the adaptive flush.
+	SetBatchSize(n int64)
+}
+
+// CounterMetrics is the default Metrics of atomic counters.
+type CounterMetrics struct {
+	requests        int64
+	pendingRequests int64
+	bytes           int64
+	flushDelay      int64
+	batchSize       int64
+}
+
+// NewMetrics returns a new CounterMetrics.
+func NewMetrics() *CounterMetrics { return &CounterMetrics{} }
+
+func (m *CounterMetrics) AddRequests(n int64) { atomic.AddInt64(&m.requests, n) }
+
+func (m *CounterMetrics) GetRequests() int64 { return atomic.LoadInt64(&m.requests) }
+
+func (m *CounterMetrics) AddPendingRequests(n int64) { atomic.AddInt64(&m.pendingRequests, n) }
+
+func (m *CounterMetrics) GetPendingRequests() int64 { return atomic.LoadInt64(&m.pendingRequests) }
+
+func (m *CounterMetrics) AddBytes(n int64) { atomic.AddInt64(&m.bytes, n) }
+
+func (m *CounterMetrics) GetBytes() int64 { return atomic.LoadInt64(&m.bytes) }
+
+func (m *CounterMetrics) SetFlushDelay(d time.Duration) { atomic.StoreInt64(&m.flushDelay, int64(d)) }
+
+func (m *CounterMetrics) GetFlushDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.flushDelay))
+}
+
+func (m *CounterMetrics) SetBatchSize(n int64) { atomic.StoreInt64(&m.batchSize, n) }
+
+func (m *CounterMetrics) GetBatchSize() int64 { return atomic.LoadInt64(&m.batchSize) }
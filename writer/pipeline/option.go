@@ -0,0 +1,165 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"runtime"
+	"time"
+)
+
+// Mode is the write mode of pipeline.
+type Mode uint8
+
+const (
+	// FlushMode copies the buffers into one and flushes it once the queue is empty
+	// or the flush interval elapsed.
+	FlushMode Mode = iota
+	// WritevMode flushes the buffers by writev (net.Buffers) without copying.
+	WritevMode
+	// ManualMode does not start the write loop, the caller drives the pipeline by
+	// Run, RunMode, the worker pool or the step API (FlushOnce, FlushUntil and Pending).
+	ManualMode
+)
+
+// Errors are the errors returned by pipeline, the compatibility shims replace them
+// with their own errors.
+type Errors struct {
+	// Closed is returned by Write and Close once the pipeline was closed.
+	Closed error
+	// TooManyWrite is returned by Write if the queue is full and blocking write is not allowed.
+	TooManyWrite error
+	// ActivelyClosed is returned by Write once the write loop exited because of Close.
+	ActivelyClosed error
+}
+
+// Option configures the pipeline.
+type Option struct {
+	mode          Mode
+	queueMode     QueueMode
+	shards        int
+	capacity      int
+	timeout       time.Duration
+	flushInterval time.Duration
+	adaptive      *AdaptiveFlush
+	blockwrite    bool
+	closeWriter   bool
+	histograms    bool
+	metrics       Metrics
+	errors        Errors
+}
+
+// NewOption returns a new Option.
+func NewOption() *Option { return &Option{} }
+
+// SetMode sets the write mode, default to FlushMode.
+func (o *Option) SetMode(m Mode) *Option {
+	o.mode = m
+	return o
+}
+
+// SetQueueMode sets the queue between the writers and the write loop, default to ChannelQueue.
+func (o *Option) SetQueueMode(m QueueMode) *Option {
+	o.queueMode = m
+	return o
+}
+
+// SetShards sets the number of shards of ShardedQueue, default to GOMAXPROCS.
+func (o *Option) SetShards(n int) *Option {
+	o.shards = n
+	return o
+}
+
+// SetCapacity sets the capacity of queue, default to 256 * NumCPU.
+// It's also the max buffers flushed by one writev.
+func (o *Option) SetCapacity(n int) *Option {
+	o.capacity = n
+	return o
+}
+
+// SetTimeout sets the timeout for write if it's net.Conn.
+func (o *Option) SetTimeout(d time.Duration) *Option {
+	o.timeout = d
+	return o
+}
+
+// SetFlushInterval sets the max delay of flush, the buffers are flushed once the
+// queue is empty if it's 0.
+func (o *Option) SetFlushInterval(d time.Duration) *Option {
+	o.flushInterval = d
+	return o
+}
+
+// SetAdaptiveFlush tunes the flush delay and batch size within the bounds from the observed
+// arrival rate and write latency, it overrides the flush interval.
+func (o *Option) SetAdaptiveFlush(a AdaptiveFlush) *Option {
+	o.adaptive = &a
+	return o
+}
+
+// AllowBlockForever indicates caller can blockly write if the queue is full.
+func (o *Option) AllowBlockForever() *Option {
+	o.blockwrite = true
+	return o
+}
+
+// EnableCloseWriter closes the underlying writer if it's io.Closer once the pipeline is closed.
+func (o *Option) EnableCloseWriter() *Option {
+	o.closeWriter = true
+	return o
+}
+
+// EnableHistograms records the histograms of queue latency, write duration and records
+// per flush, see Pipeline.GetHistograms.
+func (o *Option) EnableHistograms() *Option {
+	o.histograms = true
+	return o
+}
+
+// SetMetrics sets the metrics, default to NewMetrics().
+func (o *Option) SetMetrics(m Metrics) *Option {
+	o.metrics = m
+	return o
+}
+
+// SetErrors sets the errors returned by pipeline, the nil errors are kept as default.
+func (o *Option) SetErrors(e Errors) *Option {
+	o.errors = e
+	return o
+}
+
+func (o *Option) polyfill() {
+	if o.capacity <= 0 {
+		o.capacity = 256 * runtime.NumCPU()
+	}
+
+	if o.adaptive != nil {
+		o.adaptive.polyfill(o.capacity)
+	}
+
+	if o.metrics == nil {
+		o.metrics = NewMetrics()
+	}
+
+	if o.errors.Closed == nil {
+		o.errors.Closed = ErrClosed
+	}
+
+	if o.errors.TooManyWrite == nil {
+		o.errors.TooManyWrite = ErrTooManyWrite
+	}
+
+	if o.errors.ActivelyClosed == nil {
+		o.errors.ActivelyClosed = o.errors.Closed
+	}
+}
@@ -0,0 +1,425 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+// Package pipeline implements the io.Writer which batch writes (maybe writev if it's net.Conn)
+// to writer through a queue, it's shared by asyncwriter and batchwriter.
+package pipeline
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+
+	uatomic "go.uber.org/atomic"
+)
+
+var (
+	// ErrClosed indicates the pipeline was closed.
+	ErrClosed = errors.New("pipeline: writer was closed")
+
+	// ErrTooManyWrite indicates pipeline cannot process the write because of
+	// too many write.
+	ErrTooManyWrite = errors.New("pipeline: writer wrote too fast")
+
+	// ErrRunning indicates the write loop is already running.
+	ErrRunning = errors.New("pipeline: write loop is already running")
+)
+
+// Callback is called once the record was delivered (nil error) or failed.
+// It's called in the write loop thus it should be fast.
+type Callback func(err error)
+
+// Pipeline queues the writes and flushes them to the writer in the write loop.
+type Pipeline struct {
+	option   *Option
+	writer   io.Writer
+	metrics  Metrics
+	queue    queue
+	adaptive *adaptive // only accessed by the write loop
+	hist     *Histograms
+	closed   uint32
+	running  uint32
+	failed   uint32 // set once werr was stored
+	exited   uint32 // set once the pending records were drained
+	werr     uatomic.Error
+}
+
+// New returns a new pipeline, the write loop is started unless it's ManualMode.
+func New(w io.Writer, o *Option) (*Pipeline, error) {
+	if o == nil {
+		o = NewOption()
+	}
+	o.polyfill()
+
+	if o.queueMode != ChannelQueue && o.queueMode != ShardedQueue {
+		return nil, errors.New("pipeline: unknown queue mode")
+	}
+
+	p := &Pipeline{
+		option:  o,
+		writer:  w,
+		metrics: o.metrics,
+		queue:   newQueue(o),
+	}
+
+	if o.histograms {
+		p.hist = &Histograms{}
+	}
+
+	if o.adaptive != nil {
+		p.adaptive = newAdaptive(*o.adaptive)
+		p.metrics.SetFlushDelay(p.adaptive.delay)
+		p.metrics.SetBatchSize(int64(p.adaptive.batch))
+	}
+
+	if o.mode != ManualMode {
+		// nolint
+		go p.Run()
+	}
+
+	return p, nil
+}
+
+// Serve is the handler of worker pool which runs the pipeline, e.g.
+//
+//	wp, _ := workerpool.New(workerpool.HandlerFunc(pipeline.Serve))
+//	wp.Serve(p)
+//
+// nolint
+func Serve(v interface{}) {
+	p, ok := v.(*Pipeline)
+	if !ok {
+		panic("failed to type casting")
+	}
+
+	p.Run()
+}
+
+// GetMetrics returns the metrics.
+func (p *Pipeline) GetMetrics() Metrics { return p.metrics }
+
+// GetHistograms returns the histograms, it's nil unless the histograms are enabled.
+func (p *Pipeline) GetHistograms() *Histograms { return p.hist }
+
+// GetWriter returns the underlying writer.
+func (p *Pipeline) GetWriter() io.Writer { return p.writer }
+
+// Len returns the number of buffers in queue.
+func (p *Pipeline) Len() int { return p.queue.len() }
+
+// Cap returns the capacity of queue.
+func (p *Pipeline) Cap() int { return p.queue.cap() }
+
+// IsClosed indicates whether pipeline was closed.
+func (p *Pipeline) IsClosed() bool {
+	return atomic.LoadUint32(&p.closed) == 1
+}
+
+// Close closes the pipeline, the write loop exits once flushed the pending buffers.
+func (p *Pipeline) Close() error {
+	if !atomic.CompareAndSwapUint32(&p.closed, 0, 1) {
+		return p.option.errors.Closed
+	}
+
+	p.queue.close()
+
+	if p.option.closeWriter {
+		if cw, ok := p.writer.(io.Closer); ok {
+			return cw.Close()
+		}
+	}
+
+	return nil
+}
+
+// Err returns the error which stopped the pipeline, it's nil unless the write loop failed
+// or the pipeline was failed by Fail.
+func (p *Pipeline) Err() error { return p.werr.Load() }
+
+// Fail stops the pipeline with err as if the write loop failed: the pending records are
+// completed with err and the later writes return it. It's used once the pipeline cannot
+// be driven anymore, e.g. the workerpool serving it was stopped. It does nothing if the
+// pipeline has failed.
+//
+// The pending records are drained by the running write loop (or FlushOnce, Pending) on
+// its way out, or by Fail itself if nothing is running.
+func (p *Pipeline) Fail(err error) {
+	if !p.setErr(err) {
+		return
+	}
+
+	if atomic.CompareAndSwapUint32(&p.closed, 0, 1) {
+		p.queue.close()
+	}
+
+	p.tryExit()
+}
+
+// Write implements io.Writer.
+func (p *Pipeline) Write(d []byte) (int, error) {
+	return p.WriteCallback(d, nil)
+}
+
+// WriteCallback writes d and calls done once it was delivered or failed,
+// done is not called if WriteCallback returns an error.
+func (p *Pipeline) WriteCallback(d []byte, done Callback) (int, error) {
+	if len(d) == 0 { // avoid send nil buffer
+		if done != nil {
+			done(nil)
+		}
+		return 0, nil
+	}
+
+	b := acquireBuffer()
+	*b = append((*b)[:0], d...)
+	return p.WriteOwnedCallback(b, done)
+}
+
+// WriteOwned writes the buffer acquired from bytespool.AcquireBytes without copying.
+// The ownership of b is transferred to the pipeline which releases it to bytespool
+// once written or failed, thus the caller must not touch b after calling.
+func (p *Pipeline) WriteOwned(b *[]byte) (int, error) {
+	return p.WriteOwnedCallback(b, nil)
+}
+
+// WriteOwnedCallback is WriteOwned with the completion callback, see WriteCallback.
+func (p *Pipeline) WriteOwnedCallback(b *[]byte, done Callback) (int, error) {
+	if b == nil || len(*b) == 0 { // avoid send nil buffer
+		if b != nil {
+			releaseBuffer(b)
+		}
+		if done != nil {
+			done(nil)
+		}
+		return 0, nil
+	}
+
+	nd := len(*b)
+
+	if err := p.werr.Load(); err != nil {
+		releaseBuffer(b)
+		return 0, err
+	}
+
+	if p.IsClosed() {
+		releaseBuffer(b)
+		return 0, p.option.errors.Closed
+	}
+
+	r := record{b: b, done: done}
+	if p.hist != nil {
+		r.at = nanotime()
+	}
+
+	p.metrics.AddPendingRequests(1)
+	if !p.queue.push(r, p.option.blockwrite, p.IsClosed) {
+		releaseBuffer(b)
+		p.metrics.AddPendingRequests(-1)
+		if p.IsClosed() {
+			return 0, p.option.errors.Closed
+		}
+		return 0, p.option.errors.TooManyWrite
+	}
+	p.metrics.AddRequests(1)
+
+	return nd, nil
+}
+
+// Run runs the write loop of the mode until closed or failed to write,
+// ManualMode writes by writev.
+func (p *Pipeline) Run() error {
+	return p.RunMode(p.option.mode)
+}
+
+// RunMode runs the write loop of the mode until closed or failed to write.
+func (p *Pipeline) RunMode(m Mode) error {
+	if !atomic.CompareAndSwapUint32(&p.running, 0, 1) {
+		return ErrRunning
+	}
+	defer p.release()
+
+	ctx := p.acquireContext(m != FlushMode)
+
+	var (
+		err           error
+		flushTimer    = getFlushTimer()
+		flushCh       <-chan time.Time
+		flushAlwaysCh = make(chan time.Time)
+	)
+
+	close(flushAlwaysCh)
+
+	flush := func() error {
+		_, err := p.flush(ctx)
+		return err
+	}
+
+	for {
+		n, closed := p.queue.poll(ctx.add)
+
+		if closed {
+			// try flush the pending buffer
+			// nolint
+			flush()
+			err = p.option.errors.ActivelyClosed
+			break
+		}
+
+		if n > 0 {
+			if ctx.full() {
+				if err = flush(); err != nil {
+					break
+				}
+				flushCh = nil
+				continue
+			}
+
+			if flushCh == nil {
+				if d := p.flushDelay(); d > 0 {
+					resetFlushTimer(flushTimer, d)
+					flushCh = flushTimer.C
+				} else {
+					flushCh = flushAlwaysCh
+				}
+			}
+			continue
+		}
+
+		// slow path
+		if p.queue.wait(flushCh) {
+			if err = flush(); err != nil {
+				break
+			}
+			flushCh = nil
+		}
+	}
+
+	putFlushTimer(flushTimer)
+	releaseContext(ctx)
+
+	return p.exit(err)
+}
+
+func (p *Pipeline) acquireContext(writev bool) *context {
+	ctx := acquireContext(p.option, p.writer, writev)
+	if p.adaptive != nil {
+		ctx.limit = p.adaptive.batch
+	}
+	return ctx
+}
+
+// flushDelay returns the delay of flush since the first pending record.
+func (p *Pipeline) flushDelay() time.Duration {
+	if p.adaptive != nil {
+		return p.adaptive.delay
+	}
+	return p.option.flushInterval
+}
+
+// flush flushes the pending records of ctx, only the delivered records are not pending.
+// It returns the number of delivered records.
+func (p *Pipeline) flush(ctx *context) (int, error) {
+	n := len(ctx.records)
+	if n == 0 || (p.adaptive == nil && p.hist == nil) {
+		nw, delivered, err := ctx.Flush()
+		p.metrics.AddPendingRequests(-int64(delivered))
+		p.metrics.AddBytes(int64(nw))
+		return delivered, err
+	}
+
+	if p.hist != nil {
+		now := nanotime()
+		for i := range ctx.records {
+			p.hist.QueueLatency.Record(now - ctx.records[i].at)
+		}
+		p.hist.RecordsPerFlush.Record(int64(n))
+	}
+
+	start := time.Now()
+	nw, delivered, err := ctx.Flush()
+	d := time.Since(start)
+	p.metrics.AddPendingRequests(-int64(delivered))
+	p.metrics.AddBytes(int64(nw))
+
+	if p.hist != nil {
+		p.hist.WriteDuration.Record(int64(d))
+	}
+
+	if p.adaptive != nil {
+		p.adaptive.observe(n, start, d)
+		ctx.limit = p.adaptive.batch
+		p.metrics.SetFlushDelay(p.adaptive.delay)
+		p.metrics.SetBatchSize(int64(p.adaptive.batch))
+	}
+
+	return delivered, err
+}
+
+// setErr stores err as the error of pipeline, it returns false if there was one.
+func (p *Pipeline) setErr(err error) bool {
+	if !atomic.CompareAndSwapUint32(&p.failed, 0, 1) {
+		return false
+	}
+	p.werr.Store(err)
+	return true
+}
+
+// release marks the consumer exited, then it exits on behalf of the consumer if the
+// pipeline was failed while the consumer was running.
+func (p *Pipeline) release() {
+	atomic.StoreUint32(&p.running, 0)
+	p.tryExit()
+}
+
+// tryExit exits the failed pipeline unless a consumer is running, the running consumer
+// exits it by release.
+func (p *Pipeline) tryExit() {
+	err := p.werr.Load()
+	if err == nil || atomic.LoadUint32(&p.exited) == 1 {
+		return
+	}
+
+	if atomic.CompareAndSwapUint32(&p.running, 0, 1) {
+		p.exit(err)
+		atomic.StoreUint32(&p.running, 0)
+	}
+}
+
+// exit stops the pipeline once the consumer exited because of err, it must be called by
+// the consumer and runs once. It returns the error of pipeline which is the error of Fail
+// if the pipeline was failed.
+func (p *Pipeline) exit(err error) error {
+	// store the write error unless it was failed and set the closed status
+	if !p.setErr(err) {
+		if ferr := p.werr.Load(); ferr != nil {
+			err = ferr
+		}
+	}
+	atomic.StoreUint32(&p.closed, 1)
+
+	if !atomic.CompareAndSwapUint32(&p.exited, 0, 1) {
+		return err
+	}
+
+	// cleanup pending records
+	p.queue.drain(func(r record) {
+		r.complete(err)
+		releaseBuffer(r.b)
+	})
+
+	// cleanup the pending commands metrics
+	p.metrics.AddPendingRequests(-p.metrics.GetPendingRequests())
+
+	return err
+}
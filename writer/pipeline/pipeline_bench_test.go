@@ -0,0 +1,79 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// syscallWriter costs about 5us per write like the syscall.
+type syscallWriter struct {
+	writes int64
+}
+
+func (w *syscallWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(&w.writes, 1)
+	for start := time.Now(); time.Since(start) < 5*time.Microsecond; {
+	}
+	return len(p), nil
+}
+
+// BenchmarkFlush shows the latency (enqueue to delivered) and throughput tradeoff of
+// the static flush delay and the adaptive flush.
+func BenchmarkFlush(b *testing.B) {
+	x := []byte("0123456789012345678901234567890123456789")
+	for _, c := range []struct {
+		name   string
+		option *Option
+	}{
+		{"static-0", NewOption()},
+		{"static-1ms", NewOption().SetFlushInterval(time.Millisecond)},
+		{"adaptive", NewOption().SetAdaptiveFlush(AdaptiveFlush{MaxDelay: time.Millisecond})},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			w := &syscallWriter{}
+			p, err := New(w, c.option.AllowBlockForever())
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			var latency int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					start := time.Now()
+					_, err := p.WriteCallback(x, func(err error) {
+						atomic.AddInt64(&latency, int64(time.Since(start)))
+					})
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			for p.GetMetrics().GetPendingRequests() > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(atomic.LoadInt64(&latency))/float64(b.N), "latency-ns/op")
+			b.ReportMetric(float64(b.N)/float64(atomic.LoadInt64(&w.writes)), "records/write")
+			// nolint
+			p.Close()
+		})
+	}
+}
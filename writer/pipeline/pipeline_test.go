@@ -0,0 +1,552 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	uatomic "go.uber.org/atomic"
+)
+
+// buffer is a goroutine safe bytes.Buffer which records the number of writes.
+type buffer struct {
+	buffer bytes.Buffer
+	mutex  sync.Mutex
+	writes int
+	werr   uatomic.Error
+	closed bool
+}
+
+func (s *buffer) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.werr.Load(); err != nil {
+		return 0, err
+	}
+	s.writes++
+	return s.buffer.Write(p)
+}
+
+func (s *buffer) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *buffer) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.buffer.String()
+}
+
+func (s *buffer) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+func TestPipelineModes(t *testing.T) {
+	for _, o := range []*Option{
+		NewOption().AllowBlockForever(),
+		NewOption().AllowBlockForever().SetMode(WritevMode),
+		NewOption().AllowBlockForever().SetQueueMode(ShardedQueue),
+		NewOption().AllowBlockForever().SetMode(WritevMode).SetQueueMode(ShardedQueue),
+		NewOption().AllowBlockForever().SetFlushInterval(5 * time.Millisecond),
+	} {
+		mw := &buffer{}
+		p, err := New(mw, o)
+		require.Nil(t, err)
+
+		for i := 0; i < 100; i++ {
+			n, err := p.Write([]byte("0123456789"))
+			require.Nil(t, err)
+			require.Equal(t, 10, n)
+		}
+
+		m := p.GetMetrics().(*CounterMetrics)
+		require.Eventually(t, func() bool {
+			return m.GetBytes() == 1000
+		}, time.Second, time.Millisecond)
+		require.Equal(t, strings.Repeat("0123456789", 100), mw.String())
+		require.Equal(t, int64(100), m.GetRequests())
+		require.Equal(t, int64(0), m.GetPendingRequests())
+
+		require.Nil(t, p.Close())
+		require.Equal(t, ErrClosed, p.Close())
+		require.False(t, mw.isClosed())
+	}
+}
+
+func TestPipelineManualMode(t *testing.T) {
+	mw := &buffer{}
+	p, err := New(mw, NewOption().SetMode(ManualMode).SetCapacity(4))
+	require.Nil(t, err)
+	require.Equal(t, 4, p.Cap())
+
+	for i := 0; i < 4; i++ {
+		_, err = p.Write([]byte("abcd"))
+		require.Nil(t, err)
+	}
+	require.Equal(t, 4, p.Len())
+	_, err = p.Write([]byte("abcd"))
+	require.Equal(t, ErrTooManyWrite, err)
+	require.Equal(t, int64(4), p.GetMetrics().GetPendingRequests())
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run() }()
+
+	require.Eventually(t, func() bool {
+		return mw.String() == strings.Repeat("abcd", 4)
+	}, time.Second, time.Millisecond)
+	require.Equal(t, ErrRunning, p.RunMode(FlushMode))
+
+	require.Nil(t, p.Close())
+	require.Equal(t, ErrClosed, <-done)
+
+	_, err = p.Write([]byte("abcd"))
+	require.Equal(t, ErrClosed, err)
+}
+
+func TestPipelineErrors(t *testing.T) {
+	var (
+		errClosed   = errors.New("closed")
+		errTooMany  = errors.New("too many")
+		errActively = errors.New("actively closed")
+	)
+
+	mw := &buffer{}
+	p, err := New(mw, NewOption().
+		EnableCloseWriter().
+		SetErrors(Errors{Closed: errClosed, TooManyWrite: errTooMany, ActivelyClosed: errActively}))
+	require.Nil(t, err)
+
+	require.Nil(t, p.Close())
+	require.True(t, mw.isClosed())
+	require.Equal(t, errClosed, p.Close())
+
+	require.Eventually(t, func() bool {
+		_, err := p.Write([]byte("abcd"))
+		return err == errActively
+	}, time.Second, time.Millisecond)
+}
+
+func TestPipelineWriteError(t *testing.T) {
+	errWrite := errors.New("write")
+
+	mw := &buffer{}
+	mw.werr.Store(errWrite)
+	p, err := New(mw, nil)
+	require.Nil(t, err)
+
+	_, err = p.Write([]byte("abcd"))
+	require.Nil(t, err)
+
+	require.Eventually(t, func() bool {
+		_, err := p.Write([]byte("abcd"))
+		return err == errWrite
+	}, time.Second, time.Millisecond)
+	require.True(t, p.IsClosed())
+	require.Equal(t, int64(0), p.GetMetrics().GetPendingRequests())
+}
+
+func TestPipelineUnknownQueueMode(t *testing.T) {
+	_, err := New(&buffer{}, NewOption().SetQueueMode(QueueMode(9)))
+	require.NotNil(t, err)
+}
+
+func TestPipelineStep(t *testing.T) {
+	for _, o := range []*Option{
+		NewOption().SetMode(ManualMode).SetCapacity(4),
+		NewOption().SetMode(ManualMode).SetCapacity(4).SetQueueMode(ShardedQueue).SetShards(2),
+	} {
+		mw := &buffer{}
+		p, err := New(mw, o)
+		require.Nil(t, err)
+
+		for i := 0; i < 4; i++ {
+			_, err = p.Write([]byte{'a' + byte(i)})
+			require.Nil(t, err)
+		}
+
+		n, err := p.FlushOnce(3)
+		require.Nil(t, err)
+		require.Equal(t, 3, n)
+		require.Equal(t, "abc", mw.String())
+
+		// the iterator excludes the step API and the write loop
+		it := p.Pending()
+		_, err = p.FlushOnce(0)
+		require.Equal(t, ErrRunning, err)
+		require.Equal(t, ErrRunning, p.Pending().Close())
+		require.True(t, it.Next())
+		require.Equal(t, "d", string(it.Bytes()))
+		require.False(t, it.Next())
+		require.Nil(t, it.Close())
+		require.Nil(t, it.Close())
+
+		// flushed batch by batch by the capacity
+		for i := 0; i < 4; i++ {
+			_, err = p.Write([]byte{'e' + byte(i)})
+			require.Nil(t, err)
+		}
+		n, err = p.FlushUntil(time.Now().Add(time.Second))
+		require.Nil(t, err)
+		require.Equal(t, 4, n)
+		require.Equal(t, "abcefgh", mw.String())
+
+		m := p.GetMetrics().(*CounterMetrics)
+		require.Equal(t, int64(0), m.GetPendingRequests())
+		require.Equal(t, int64(8), m.GetBytes())
+
+		require.Nil(t, p.Close())
+		it = p.Pending()
+		require.False(t, it.Next())
+		require.Equal(t, ErrClosed, it.Close())
+		_, err = p.FlushOnce(0)
+		require.Equal(t, ErrClosed, err)
+	}
+}
+
+func TestPipelineStepWriteError(t *testing.T) {
+	errWrite := errors.New("write")
+
+	mw := &buffer{}
+	mw.werr.Store(errWrite)
+	p, err := New(mw, NewOption().SetMode(ManualMode))
+	require.Nil(t, err)
+
+	_, err = p.Write([]byte("abcd"))
+	require.Nil(t, err)
+
+	n, err := p.FlushOnce(0)
+	require.Equal(t, errWrite, err)
+	require.Equal(t, 0, n)
+	require.True(t, p.IsClosed())
+
+	_, err = p.Write([]byte("abcd"))
+	require.Equal(t, errWrite, err)
+}
+
+// shortWriter writes at most max bytes each time and fails once wrote limit bytes.
+type shortWriter struct {
+	buffer bytes.Buffer
+	max    int
+	limit  int
+}
+
+func (s *shortWriter) Write(p []byte) (int, error) {
+	if s.buffer.Len() >= s.limit {
+		return 0, errors.New("short")
+	}
+	if len(p) > s.max {
+		p = p[:s.max]
+	}
+	if left := s.limit - s.buffer.Len(); len(p) > left {
+		p = p[:left]
+	}
+	return s.buffer.Write(p)
+}
+
+func TestPipelineShortWrite(t *testing.T) {
+	// FlushMode copies the records into one buffer and ManualMode flushes them by writev
+	for _, m := range []Mode{FlushMode, ManualMode} {
+		mw := &shortWriter{max: 3, limit: 1 << 20}
+		p, err := New(mw, NewOption().SetMode(m).SetCapacity(16))
+		require.Nil(t, err)
+
+		for i := 0; i < 10; i++ {
+			_, err = p.Write([]byte("0123456789"))
+			require.Nil(t, err)
+		}
+
+		if m == ManualMode {
+			n, err := p.FlushOnce(0)
+			require.Nil(t, err)
+			require.Equal(t, 10, n)
+		}
+
+		require.Eventually(t, func() bool {
+			return p.GetMetrics().GetPendingRequests() == 0
+		}, time.Second, time.Millisecond)
+		require.Nil(t, p.Close())
+		require.Equal(t, strings.Repeat("0123456789", 10), mw.buffer.String())
+	}
+}
+
+// overWriter reports more bytes than it was given like a writer returning the framed length.
+type overWriter struct {
+	buffer bytes.Buffer
+}
+
+func (s *overWriter) Write(p []byte) (int, error) {
+	n, err := s.buffer.Write(p)
+	return n + 16, err
+}
+
+func TestPipelineOverReportedWrite(t *testing.T) {
+	for _, m := range []Mode{FlushMode, ManualMode} {
+		mw := &overWriter{}
+		p, err := New(mw, NewOption().SetMode(m).SetCapacity(16))
+		require.Nil(t, err)
+
+		done := make(chan error, 4)
+		for i := 0; i < 4; i++ {
+			_, err = p.WriteCallback([]byte("0123456789"), func(err error) { done <- err })
+			require.Nil(t, err)
+		}
+
+		if m == ManualMode {
+			// the following buffers are not skipped by the over-reported bytes
+			n, err := p.FlushOnce(0)
+			require.Nil(t, err)
+			require.Equal(t, 4, n)
+		}
+
+		require.Eventually(t, func() bool {
+			return p.GetMetrics().GetPendingRequests() == 0
+		}, time.Second, time.Millisecond)
+		require.Nil(t, p.Close())
+		require.Equal(t, strings.Repeat("0123456789", 4), mw.buffer.String())
+		require.Equal(t, int64(40), p.GetMetrics().(*CounterMetrics).GetBytes())
+		for i := 0; i < 4; i++ {
+			require.Nil(t, <-done)
+		}
+	}
+}
+
+// connPair returns the connected TCP connections with the small send buffer thus the
+// writev of the client is split by the kernel.
+func connPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			conn = nil
+		}
+		accepted <- conn
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.Nil(t, err)
+	server := <-accepted
+	require.NotNil(t, server)
+
+	cc, sc := client.(*net.TCPConn), server.(*net.TCPConn)
+	require.Nil(t, cc.SetWriteBuffer(16<<10))
+	return cc, sc
+}
+
+func TestPipelineConnShortWrite(t *testing.T) {
+	const (
+		records = 64
+		size    = 16 << 10
+	)
+	var expected bytes.Buffer
+	for i := 0; i < records; i++ {
+		expected.Write(bytes.Repeat([]byte{byte('a' + i%26)}, size))
+	}
+
+	write := func(p *Pipeline) {
+		for i := 0; i < records; i++ {
+			_, err := p.Write(expected.Bytes()[i*size : (i+1)*size])
+			require.Nil(t, err)
+		}
+	}
+
+	// the writev is resumed from the short write until all of the buffers are written
+	client, server := connPair(t)
+	received := make(chan []byte, 1)
+	go func() {
+		b, _ := ioutil.ReadAll(server)
+		received <- b
+	}()
+
+	p, err := New(client, NewOption().SetMode(ManualMode).SetCapacity(records))
+	require.Nil(t, err)
+	write(p)
+	n, err := p.FlushOnce(0)
+	require.Nil(t, err)
+	require.Equal(t, records, n)
+	require.Nil(t, client.Close())
+	require.True(t, bytes.Equal(expected.Bytes(), <-received))
+	require.Nil(t, server.Close())
+
+	// the records written entirely are delivered even if the writev timed out in the middle
+	client, server = connPair(t)
+	p, err = New(client, NewOption().SetMode(ManualMode).SetCapacity(records).SetTimeout(50*time.Millisecond))
+	require.Nil(t, err)
+	write(p)
+	n, err = p.FlushOnce(0)
+	require.NotNil(t, err)
+	nerr, ok := err.(net.Error)
+	require.True(t, ok && nerr.Timeout(), "unexpected error %v", err)
+
+	written := p.GetMetrics().(*CounterMetrics).GetBytes()
+	require.True(t, written < int64(expected.Len()))
+	require.Equal(t, int(written/size), n)
+
+	require.Nil(t, client.Close())
+	b, err := ioutil.ReadAll(server)
+	require.Nil(t, err)
+	require.True(t, bytes.Equal(expected.Bytes()[:written], b))
+	require.Nil(t, server.Close())
+}
+
+func TestPipelineCallback(t *testing.T) {
+	for _, o := range []*Option{
+		NewOption().SetMode(ManualMode),
+		NewOption().SetMode(ManualMode).SetQueueMode(ShardedQueue),
+	} {
+		// the writer fails in the middle of the third record
+		mw := &shortWriter{max: 4, limit: 25}
+		p, err := New(mw, o)
+		require.Nil(t, err)
+
+		var (
+			results = make([]error, 5)
+			called  = make([]int, 5)
+		)
+		for i := 0; i < 4; i++ {
+			i := i
+			_, err = p.WriteCallback([]byte("0123456789"), func(err error) {
+				results[i] = err
+				called[i]++
+			})
+			require.Nil(t, err)
+		}
+		require.Equal(t, int64(4), p.GetMetrics().GetPendingRequests())
+
+		n, err := p.FlushOnce(0)
+		require.NotNil(t, err)
+		require.Equal(t, 2, n)
+		require.Equal(t, []int{1, 1, 1, 1, 0}, called)
+		require.Nil(t, results[0])
+		require.Nil(t, results[1])
+		require.Equal(t, err, results[2])
+		require.Equal(t, err, results[3])
+		require.Equal(t, int64(25), p.GetMetrics().(*CounterMetrics).GetBytes())
+		require.Equal(t, int64(0), p.GetMetrics().GetPendingRequests())
+
+		// the callback is not called if failed to write
+		_, err = p.WriteCallback([]byte("abcd"), func(err error) { called[4]++ })
+		require.NotNil(t, err)
+		require.Equal(t, 0, called[4])
+	}
+}
+
+func TestPipelineCallbackDrained(t *testing.T) {
+	mw := &buffer{}
+	mw.werr.Store(errors.New("write"))
+	p, err := New(mw, NewOption().SetMode(ManualMode))
+	require.Nil(t, err)
+
+	results := make([]error, 2)
+	for i := range results {
+		i := i
+		_, err = p.WriteCallback([]byte("abcd"), func(err error) { results[i] = err })
+		require.Nil(t, err)
+	}
+	_, err = p.WriteCallback(nil, func(err error) { require.Nil(t, err) })
+	require.Nil(t, err)
+
+	// the first record failed to flush and the second one is drained
+	_, err = p.FlushOnce(1)
+	require.NotNil(t, err)
+	require.Equal(t, err, results[0])
+	require.Equal(t, err, results[1])
+}
+
+func TestPipelineFail(t *testing.T) {
+	var (
+		e1     = errors.New("fail 1")
+		e2     = errors.New("fail 2")
+		called = make([]error, 0, 4)
+		done   = func(err error) { called = append(called, err) }
+	)
+
+	// nothing is running thus Fail drains the pending records by itself
+	p, err := New(&buffer{}, NewOption().SetMode(ManualMode))
+	require.Nil(t, err)
+	_, err = p.WriteCallback([]byte("abcd"), done)
+	require.Nil(t, err)
+	p.Fail(e1)
+	p.Fail(e2)
+	require.Equal(t, []error{e1}, called)
+	require.Equal(t, e1, p.Err())
+	require.True(t, p.IsClosed())
+	_, err = p.FlushOnce(0)
+	require.Equal(t, e1, err)
+	_, err = p.Write([]byte("abcd"))
+	require.Equal(t, e1, err)
+
+	// the running consumer drains the pending records on its way out
+	called = called[:0]
+	p, err = New(&buffer{}, NewOption().SetMode(ManualMode).SetQueueMode(ShardedQueue))
+	require.Nil(t, err)
+	_, err = p.WriteCallback([]byte("abcd"), done)
+	require.Nil(t, err)
+	it := p.Pending()
+	p.Fail(e1)
+	require.Empty(t, called)
+	require.Nil(t, it.Close())
+	require.Equal(t, []error{e1}, called)
+	require.Equal(t, int64(0), p.GetMetrics().GetPendingRequests())
+}
+
+func TestPipelineFailConcurrently(t *testing.T) {
+	p, err := New(&buffer{}, NewOption().SetCapacity(1024))
+	require.Nil(t, err)
+
+	var (
+		called  uatomic.Int64
+		written int64
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 512; i++ {
+		if _, err := p.WriteCallback([]byte("abcd"), func(error) { called.Inc() }); err == nil {
+			written++
+		}
+		if i == 256 {
+			for j := 0; j < 4; j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					p.Fail(errors.New("fail"))
+				}()
+			}
+		}
+	}
+	wg.Wait()
+
+	// every record is completed exactly once
+	require.Eventually(t, func() bool {
+		return called.Load() == written
+	}, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, written, called.Load())
+	require.EqualError(t, p.Err(), "fail")
+}
@@ -0,0 +1,527 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueueMode is the queue between the writers and the write loop.
+type QueueMode uint8
+
+const (
+	// ChannelQueue funnels the writes through one buffered channel.
+	ChannelQueue QueueMode = iota
+	// ShardedQueue spreads the writes over lock-free ring buffers (GOMAXPROCS shards by default)
+	// and the write loop batches across the shards. The writes of one goroutine are kept in
+	// order but the concurrent writes may be reordered. It contends much less than ChannelQueue
+	// with many writers.
+	ShardedQueue
+)
+
+// record is the buffer written to pipeline with the completion callback.
+type record struct {
+	b    *[]byte
+	done Callback
+	at   int64 // the nanotime of enqueue if the histograms are enabled
+}
+
+// complete calls the completion callback if any.
+func (r record) complete(err error) {
+	if r.done != nil {
+		r.done(err)
+	}
+}
+
+// queue is the multi-producer single-consumer queue of records.
+type queue interface {
+	// push pushes r, it waits until the queue is not full or stop returns true if block.
+	push(r record, block bool, stop func() bool) bool
+	// poll pops the available records to fn without blocking until fn returns false,
+	// it returns the number of records and whether the queue was closed.
+	poll(fn func(r record) bool) (int64, bool)
+	// wait blocks until the buffers are available, the queue was closed or ch fired,
+	// it returns true if ch fired.
+	wait(ch <-chan time.Time) bool
+	// close closes the queue thus the consumer sees it after polled the pending buffers.
+	close()
+	// drain releases all of records once the consumer exited.
+	drain(release func(r record))
+	len() int
+	cap() int
+}
+
+func newQueue(o *Option) queue {
+	if o.queueMode == ShardedQueue {
+		return newShardedQueue(o.shards, o.capacity)
+	}
+	return newChanQueue(o.capacity)
+}
+
+// chanQueue is the queue of channel, done is closed once the queue was closed thus
+// neither close nor the blocked writers wait for a consumer.
+type chanQueue struct {
+	ch     chan record
+	peek   record
+	peeked bool
+	closed uint32
+	once   sync.Once
+	done   chan struct{}
+}
+
+func newChanQueue(size int) *chanQueue {
+	return &chanQueue{
+		ch:   make(chan record, size),
+		done: make(chan struct{}),
+	}
+}
+
+func (q *chanQueue) push(r record, block bool, stop func() bool) bool {
+	if atomic.LoadUint32(&q.closed) == 1 {
+		return false
+	}
+
+	if !block {
+		select {
+		case q.ch <- r:
+			return true
+		default:
+			return false
+		}
+	}
+
+	select {
+	case q.ch <- r:
+		return true
+	case <-q.done:
+		return false
+	}
+}
+
+func (q *chanQueue) poll(fn func(r record) bool) (int64, bool) {
+	var n int64
+	for {
+		var d record
+		if q.peeked {
+			d, q.peek, q.peeked = q.peek, record{}, false
+		} else {
+			select {
+			case d = <-q.ch:
+			default:
+				// the queue is empty, the consumer sees close once polled the pending buffers
+				return n, atomic.LoadUint32(&q.closed) == 1
+			}
+		}
+
+		n++
+		if !fn(d) {
+			return n, false
+		}
+	}
+}
+
+func (q *chanQueue) wait(ch <-chan time.Time) bool {
+	if q.peeked {
+		return false
+	}
+
+	select {
+	case <-ch:
+		return true
+	case q.peek = <-q.ch:
+		q.peeked = true
+		return false
+	case <-q.done:
+		return false
+	}
+}
+
+func (q *chanQueue) close() {
+	q.once.Do(func() {
+		atomic.StoreUint32(&q.closed, 1)
+		close(q.done)
+	})
+}
+
+func (q *chanQueue) drain(release func(r record)) {
+	// the blocked writers give up instead of refilling the drained queue
+	q.close()
+
+	if q.peeked {
+		release(q.peek)
+	}
+	q.peek, q.peeked = record{}, false
+
+	for len(q.ch) > 0 {
+		select {
+		case d := <-q.ch:
+			release(d)
+		default:
+		}
+	}
+}
+
+func (q *chanQueue) len() int { return len(q.ch) }
+
+func (q *chanQueue) cap() int { return cap(q.ch) }
+
+const cacheLinePadSize = 64
+
+type cacheLinePad [cacheLinePadSize]byte
+
+type ringCell struct {
+	seq    uint64
+	ticket uint64
+	r      record
+}
+
+// ring is a bounded multi-producer single-consumer lock-free queue.
+type ring struct {
+	_     cacheLinePad
+	head  uint64 // the next position to push
+	_     cacheLinePad
+	tail  uint64 // the next position to pop, only updated by the consumer
+	_     cacheLinePad
+	mask  uint64
+	cells []ringCell
+}
+
+func newRing(size int) *ring {
+	n := 2
+	for n < size {
+		n <<= 1
+	}
+
+	r := &ring{
+		mask:  uint64(n - 1),
+		cells: make([]ringCell, n),
+	}
+	for i := range r.cells {
+		r.cells[i].seq = uint64(i)
+	}
+	return r
+}
+
+// push returns false if the ring is full.
+func (r *ring) push(rec record, ticket uint64) bool {
+	pos := atomic.LoadUint64(&r.head)
+	for {
+		c := &r.cells[pos&r.mask]
+		seq := atomic.LoadUint64(&c.seq)
+		switch dif := int64(seq - pos); {
+		case dif == 0:
+			if atomic.CompareAndSwapUint64(&r.head, pos, pos+1) {
+				c.r = rec
+				c.ticket = ticket
+				atomic.StoreUint64(&c.seq, pos+1)
+				return true
+			}
+		case dif < 0:
+			return false
+		}
+		pos = atomic.LoadUint64(&r.head)
+	}
+}
+
+// pop returns false if the ring is empty.
+func (r *ring) pop() (record, uint64, bool) {
+	pos := atomic.LoadUint64(&r.tail)
+	c := &r.cells[pos&r.mask]
+	if atomic.LoadUint64(&c.seq) != pos+1 {
+		return record{}, 0, false
+	}
+
+	rec, ticket := c.r, c.ticket
+	c.r = record{}
+	atomic.StoreUint64(&r.tail, pos+1)
+	atomic.StoreUint64(&c.seq, pos+r.mask+1)
+	return rec, ticket, true
+}
+
+// blocked returns the lowest ticket of the buffers which cannot be popped because of an
+// earlier cell claimed but not yet published, it's only called by the consumer.
+func (r *ring) blocked() (uint64, bool) {
+	var (
+		min uint64
+		ok  bool
+	)
+	head := atomic.LoadUint64(&r.head)
+	for pos := atomic.LoadUint64(&r.tail); pos != head; pos++ {
+		c := &r.cells[pos&r.mask]
+		if atomic.LoadUint64(&c.seq) != pos+1 {
+			continue
+		}
+		if !ok || c.ticket < min {
+			min, ok = c.ticket, true
+		}
+	}
+	return min, ok
+}
+
+// empty reports whether there is no buffer to pop, it's only called by the consumer.
+func (r *ring) empty() bool {
+	pos := atomic.LoadUint64(&r.tail)
+	return atomic.LoadUint64(&r.cells[pos&r.mask].seq) != pos+1
+}
+
+func (r *ring) len() int {
+	return int(atomic.LoadUint64(&r.head) - atomic.LoadUint64(&r.tail))
+}
+
+// ticketed is the record with the ticket of push.
+type ticketed struct {
+	ticket uint64
+	r      record
+}
+
+type byTicket []ticketed
+
+func (t byTicket) Len() int           { return len(t) }
+func (t byTicket) Less(i, j int) bool { return t[i].ticket < t[j].ticket }
+func (t byTicket) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+// shardedQueue spreads the buffers over rings and wakes up the consumer
+// only if it's waiting.
+//
+// Every push takes a ticket which also selects the shard. The consumer takes a snapshot
+// of the ticket before draining the shards, then it only pops the buffers whose tickets are
+// not greater than the snapshot and lower than the buffers blocked behind the cells claimed
+// but not yet published in the order of tickets, it holds the others to the next poll.
+// Thus the writes of one goroutine are kept in order: if a write is popped its previous
+// writes were pushed before the snapshot and were popped or are blocked in a shard.
+type shardedQueue struct {
+	shards  []*ring
+	ticket  uint64
+	held    []ticketed // only accessed by the consumer
+	waiting uint32
+	closed  uint32
+	notify  chan struct{}
+
+	// the writers blocked by the full queue wait for space which is closed once polled
+	blocked int32
+	mu      sync.Mutex
+	space   chan struct{}
+}
+
+func newShardedQueue(shards int, size int) *shardedQueue {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+
+	q := &shardedQueue{
+		shards: make([]*ring, shards),
+		notify: make(chan struct{}, 1),
+		space:  make(chan struct{}),
+	}
+	for i := range q.shards {
+		q.shards[i] = newRing((size + shards - 1) / shards)
+	}
+	return q
+}
+
+func (q *shardedQueue) push(r record, block bool, stop func() bool) bool {
+	if q.tryPush(r) {
+		return true
+	}
+
+	if !block {
+		return false
+	}
+
+	// spin a while before parking
+	for i := 0; i < 4; i++ {
+		runtime.Gosched()
+		if q.tryPush(r) {
+			return true
+		}
+	}
+
+	atomic.AddInt32(&q.blocked, 1)
+	defer atomic.AddInt32(&q.blocked, -1)
+
+	for !stop() {
+		q.mu.Lock()
+		space := q.space
+		q.mu.Unlock()
+
+		if q.tryPush(r) {
+			return true
+		}
+
+		q.signal()
+		<-space
+	}
+
+	return false
+}
+
+// tryPush tries the shards in round-robin and returns false if all of them are full.
+func (q *shardedQueue) tryPush(r record) bool {
+	n := uint64(len(q.shards))
+	ticket := atomic.AddUint64(&q.ticket, 1)
+	for i := uint64(0); i < n; i++ {
+		if q.shards[(ticket+i)%n].push(r, ticket) {
+			q.wakeup()
+			return true
+		}
+	}
+	return false
+}
+
+// release wakes up the writers blocked by the full queue.
+func (q *shardedQueue) release() {
+	if atomic.LoadInt32(&q.blocked) == 0 {
+		return
+	}
+	q.broadcast()
+}
+
+func (q *shardedQueue) broadcast() {
+	q.mu.Lock()
+	close(q.space)
+	q.space = make(chan struct{})
+	q.mu.Unlock()
+}
+
+// wakeup notifies the consumer if it's waiting.
+func (q *shardedQueue) wakeup() {
+	if atomic.LoadUint32(&q.waiting) == 1 && atomic.CompareAndSwapUint32(&q.waiting, 1, 0) {
+		q.signal()
+	}
+}
+
+func (q *shardedQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *shardedQueue) poll(fn func(r record) bool) (int64, bool) {
+	limit := atomic.LoadUint64(&q.ticket)
+
+	popped := false
+	for _, r := range q.shards {
+		for rec, ticket, ok := r.pop(); ok; rec, ticket, ok = r.pop() {
+			q.held = append(q.held, ticketed{ticket: ticket, r: rec})
+			popped = true
+		}
+	}
+	if popped {
+		q.release()
+		sort.Sort(byTicket(q.held))
+	}
+
+	// the blocked buffers are scanned after popping thus the previous writes of the
+	// popped ones are seen
+	watermark := limit + 1
+	for _, r := range q.shards {
+		if ticket, ok := r.blocked(); ok && ticket < watermark {
+			watermark = ticket
+		}
+	}
+
+	var (
+		n int64
+		i int
+	)
+	for i < len(q.held) && q.held[i].ticket < watermark {
+		r := q.held[i].r
+		q.held[i].r = record{}
+		i++
+		n++
+		if !fn(r) {
+			break
+		}
+	}
+	q.held = q.held[:copy(q.held, q.held[i:])]
+
+	if n == 0 && len(q.held) == 0 && atomic.LoadUint32(&q.closed) == 1 {
+		return 0, true
+	}
+	return n, false
+}
+
+func (q *shardedQueue) empty() bool {
+	if len(q.held) > 0 {
+		return false
+	}
+
+	for _, r := range q.shards {
+		if !r.empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// wait marks the consumer is waiting then checks the shards again thus
+// the buffers pushed before marking are not missed.
+func (q *shardedQueue) wait(ch <-chan time.Time) bool {
+	atomic.StoreUint32(&q.waiting, 1)
+	if !q.empty() || atomic.LoadUint32(&q.closed) == 1 {
+		atomic.StoreUint32(&q.waiting, 0)
+		return false
+	}
+
+	select {
+	case <-ch:
+		return true
+	case <-q.notify:
+		return false
+	}
+}
+
+func (q *shardedQueue) close() {
+	atomic.StoreUint32(&q.closed, 1)
+	q.signal()
+	q.broadcast()
+}
+
+func (q *shardedQueue) drain(release func(r record)) {
+	for i := range q.held {
+		release(q.held[i].r)
+		q.held[i].r = record{}
+	}
+	q.held = q.held[:0]
+
+	for _, r := range q.shards {
+		for rec, _, ok := r.pop(); ok; rec, _, ok = r.pop() {
+			release(rec)
+		}
+	}
+
+	// wake up the blocked writers which see the closed status
+	q.broadcast()
+}
+
+func (q *shardedQueue) len() int {
+	n := 0
+	for _, r := range q.shards {
+		n += r.len()
+	}
+	return n
+}
+
+func (q *shardedQueue) cap() int {
+	n := 0
+	for _, r := range q.shards {
+		n += len(r.cells)
+	}
+	return n
+}
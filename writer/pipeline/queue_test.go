@@ -0,0 +1,214 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package pipeline
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	r := newRing(3)
+	require.Len(t, r.cells, 4)
+
+	bs := make([][]byte, 5)
+	for i := 0; i < 4; i++ {
+		bs[i] = []byte{byte(i)}
+		require.True(t, r.push(record{b: &bs[i]}, uint64(i)))
+	}
+	require.False(t, r.push(record{b: &bs[4]}, 4))
+	require.Equal(t, 4, r.len())
+
+	for i := 0; i < 4; i++ {
+		rec, ticket, ok := r.pop()
+		require.True(t, ok)
+		require.Equal(t, []byte{byte(i)}, *rec.b)
+		require.Equal(t, uint64(i), ticket)
+	}
+	_, _, ok := r.pop()
+	require.False(t, ok)
+	require.True(t, r.empty())
+	require.True(t, r.push(record{b: &bs[4]}, 4))
+	rec, _, ok := r.pop()
+	require.True(t, ok)
+	require.Equal(t, &bs[4], rec.b)
+}
+
+func TestShardedQueueBlockedShard(t *testing.T) {
+	q := newShardedQueue(2, 8)
+	bs := make([][]byte, 4)
+	for i := range bs {
+		bs[i] = []byte{byte(i)}
+	}
+
+	// the ticket 1 claims a cell of the shard 1 but does not publish it yet
+	r := q.shards[1]
+	pos := atomic.AddUint64(&r.head, 1) - 1
+	atomic.AddUint64(&q.ticket, 1)
+
+	// the ticket 2 goes to the shard 0, 3 is blocked in the shard 1 and 4 goes to the shard 0
+	for i := 1; i < 4; i++ {
+		require.True(t, q.push(record{b: &bs[i]}, false, nil))
+	}
+
+	var popped []byte
+	consume := func(r record) bool {
+		popped = append(popped, (*r.b)[0])
+		return true
+	}
+
+	// the ticket 4 is held since the ticket 3 was pushed before it
+	n, closed := q.poll(consume)
+	require.False(t, closed)
+	require.Equal(t, int64(1), n)
+	require.Equal(t, []byte{1}, popped)
+
+	c := &r.cells[pos&r.mask]
+	c.r = record{b: &bs[0]}
+	c.ticket = 1
+	atomic.StoreUint64(&c.seq, pos+1)
+
+	n, _ = q.poll(consume)
+	require.Equal(t, int64(3), n)
+	require.Equal(t, []byte{1, 0, 2, 3}, popped)
+}
+
+func TestQueueConcurrent(t *testing.T) {
+	for _, q := range []queue{
+		newChanQueue(64),
+		newShardedQueue(4, 64),
+	} {
+		testQueueConcurrent(t, q)
+	}
+}
+
+func testQueueConcurrent(t *testing.T, q queue) {
+	const (
+		producers = 8
+		count     = 10000
+	)
+
+	stop := func() bool { return false }
+
+	var wg sync.WaitGroup
+	wg.Add(producers)
+	for p := 0; p < producers; p++ {
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				b := []byte{byte(p), byte(i)}
+				require.True(t, q.push(record{b: &b}, true, stop))
+			}
+		}(p)
+	}
+
+	go func() {
+		wg.Wait()
+		q.close()
+	}()
+
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+
+	counts := make([]int, producers)
+	last := make([]int, producers)
+	for i := range last {
+		last[i] = -1
+	}
+	consume := func(r record) bool {
+		p, i := (*r.b)[0], int((*r.b)[1])
+		counts[p]++
+		// the order of one producer is kept
+		require.Equal(t, (last[p]+1)%256, i)
+		last[p] = i
+		return true
+	}
+
+	for {
+		n, closed := q.poll(consume)
+		if closed {
+			break
+		}
+		if n == 0 {
+			q.wait(tick.C)
+		}
+	}
+
+	for p := range counts {
+		require.Equal(t, count, counts[p])
+	}
+	require.Equal(t, 0, q.len())
+}
+
+func TestQueueFull(t *testing.T) {
+	for _, q := range []queue{
+		newChanQueue(2),
+		newShardedQueue(1, 2),
+	} {
+		bs := make([][]byte, 3)
+		require.True(t, q.push(record{b: &bs[0]}, false, nil))
+		require.True(t, q.push(record{b: &bs[1]}, false, nil))
+		require.False(t, q.push(record{b: &bs[2]}, false, nil))
+		require.Equal(t, 2, q.len())
+		require.Equal(t, 2, q.cap())
+
+		// the blocked push returns once stopped
+		var stopped uint32
+		done := make(chan bool)
+		go func() {
+			done <- q.push(record{b: &bs[2]}, true, func() bool { return atomic.LoadUint32(&stopped) == 1 })
+		}()
+
+		n, closed := q.poll(func(r record) bool { return false })
+		require.Equal(t, int64(1), n)
+		require.False(t, closed)
+		require.True(t, <-done)
+
+		atomic.StoreUint32(&stopped, 1)
+		var released int
+		q.drain(func(r record) { released++ })
+		require.Equal(t, 2, released)
+	}
+}
+
+func TestQueueCloseFull(t *testing.T) {
+	for _, q := range []queue{
+		newChanQueue(2),
+		newShardedQueue(1, 2),
+	} {
+		bs := make([][]byte, 3)
+		require.True(t, q.push(record{b: &bs[0]}, false, nil))
+		require.True(t, q.push(record{b: &bs[1]}, false, nil))
+
+		// close never waits for the consumer even if the queue is full
+		q.close()
+		require.False(t, q.push(record{b: &bs[2]}, true, func() bool { return true }))
+
+		// the consumer sees close once polled the pending buffers
+		var total int64
+		for {
+			n, closed := q.poll(func(r record) bool { return true })
+			total += n
+			if closed {
+				break
+			}
+			require.False(t, q.wait(nil))
+		}
+		require.Equal(t, int64(2), total)
+	}
+}
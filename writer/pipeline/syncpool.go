@@ -11,26 +11,20 @@
 //
 //
 
-package asyncwriter
+package pipeline
 
 import (
 	"io"
 	"net"
 	"sync"
 	"time"
-)
 
-var (
-	bpool = sync.Pool{
-		New: func() interface{} {
-			var b []byte
-			return &b
-		},
-	}
-	ctxpool = sync.Pool{}
+	"github.com/sofastack/sofa-common-go/syncpool/bytespool"
 )
 
-func acquireContext(o *Option, w io.Writer) *context {
+var ctxpool sync.Pool
+
+func acquireContext(o *Option, w io.Writer, writev bool) *context {
 	var ctx *context
 	i := ctxpool.Get()
 	if i == nil {
@@ -43,13 +37,14 @@ func acquireContext(o *Option, w io.Writer) *context {
 		}
 	}
 
-	if conn, ok := w.(net.Conn); ok {
-		ctx.conn = conn
-	}
+	ctx.conn, _ = w.(net.Conn)
 	ctx.option = o
 	ctx.writer = w
-	ctx.buffers = ctx.buffers[:0]
-	ctx.buffersp = ctx.buffersp[:0]
+	ctx.writev = writev
+	if writev {
+		// the max iovecs of writev
+		ctx.limit = o.capacity
+	}
 
 	return ctx
 }
@@ -60,12 +55,11 @@ func releaseContext(ctx *context) {
 }
 
 func acquireBuffer() *[]byte {
-	return bpool.Get().(*[]byte)
+	return bytespool.AcquireBytes()
 }
 
 func releaseBuffer(b *[]byte) {
-	*b = (*b)[:0]
-	bpool.Put(b)
+	bytespool.ReleaseBytes(b)
 }
 
 var flushTimerPool sync.Pool
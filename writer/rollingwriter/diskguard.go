@@ -0,0 +1,324 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package rollingwriter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DiskStat represents the usage of the file system.
+type DiskStat struct {
+	TotalBytes  uint64
+	FreeBytes   uint64
+	TotalInodes uint64
+	FreeInodes  uint64
+}
+
+// DiskGuardOption configures the thresholds and actions of DiskGuard.
+type DiskGuardOption struct {
+	minFreeBytes      uint64
+	minFreeRatio      float64
+	minFreeInodes     uint64
+	minFreeInodeRatio float64
+	checkInterval     time.Duration
+	backupGlob        string
+	dropLowLevel      bool
+	fallback          io.Writer
+	statDisk          func(path string) (DiskStat, error)
+}
+
+// NewDiskGuardOption returns a new DiskGuardOption.
+func NewDiskGuardOption() *DiskGuardOption {
+	return &DiskGuardOption{}
+}
+
+// SetMinFreeBytes sets the min free bytes of the file system.
+func (o *DiskGuardOption) SetMinFreeBytes(n uint64) *DiskGuardOption { o.minFreeBytes = n; return o }
+
+// SetMinFreeRatio sets the min free ratio (0.05 means 5%) of the file system.
+func (o *DiskGuardOption) SetMinFreeRatio(r float64) *DiskGuardOption { o.minFreeRatio = r; return o }
+
+// SetMinFreeInodes sets the min free inodes of the file system.
+func (o *DiskGuardOption) SetMinFreeInodes(n uint64) *DiskGuardOption { o.minFreeInodes = n; return o }
+
+// SetMinFreeInodeRatio sets the min free inode ratio of the file system.
+func (o *DiskGuardOption) SetMinFreeInodeRatio(r float64) *DiskGuardOption {
+	o.minFreeInodeRatio = r
+	return o
+}
+
+// SetCheckInterval sets the interval of checking the file system (default 1s).
+func (o *DiskGuardOption) SetCheckInterval(d time.Duration) *DiskGuardOption {
+	o.checkInterval = d
+	return o
+}
+
+// EnableDeleteBackups deletes the oldest backups matched the glob first if the disk is low,
+// the file being written and the lock files are never deleted, see BackupGlobber.
+func (o *DiskGuardOption) EnableDeleteBackups(glob string) *DiskGuardOption {
+	o.backupGlob = glob
+	return o
+}
+
+// EnableDropLowLevel drops the DEBUG/INFO records written by WriteLevel if the disk is low,
+// the records written by Write are never dropped since their levels are unknown.
+func (o *DiskGuardOption) EnableDropLowLevel() *DiskGuardOption {
+	o.dropLowLevel = true
+	return o
+}
+
+// InfoLevel is the level of INFO records passed to LevelWriter, the levels are ordered
+// as zapcore.Level thus DEBUG is -1 and WARN is 1.
+const InfoLevel int8 = 0
+
+// LevelWriter writes the record with its level thus the writer degrades by level
+// without parsing the record.
+type LevelWriter interface {
+	WriteLevel(level int8, p []byte) (int, error)
+}
+
+// BackupGlobber returns the glob pattern which matches the backups of the writer.
+type BackupGlobber interface {
+	BackupGlob() string
+}
+
+var (
+	_ LevelWriter   = (*DiskGuard)(nil)
+	_ BackupGlobber = (*RollingWriter)(nil)
+	_ BackupGlobber = (*TimeRollingWriter)(nil)
+)
+
+// SetFallback switches the writes to the fallback writer if the disk is low.
+func (o *DiskGuardOption) SetFallback(w io.Writer) *DiskGuardOption { o.fallback = w; return o }
+
+// DiskGuardMetrics counts the actions taken by DiskGuard.
+type DiskGuardMetrics struct {
+	lowDisk        int64
+	deletedBackups int64
+	dropped        int64
+	fallback       int64
+}
+
+// GetLowDisk returns the number of checks which found the disk low.
+func (m *DiskGuardMetrics) GetLowDisk() int64 { return atomic.LoadInt64(&m.lowDisk) }
+
+// GetDeletedBackups returns the number of deleted backups.
+func (m *DiskGuardMetrics) GetDeletedBackups() int64 { return atomic.LoadInt64(&m.deletedBackups) }
+
+// GetDropped returns the number of dropped records.
+func (m *DiskGuardMetrics) GetDropped() int64 { return atomic.LoadInt64(&m.dropped) }
+
+// GetFallback returns the number of records written to the fallback writer.
+func (m *DiskGuardMetrics) GetFallback() int64 { return atomic.LoadInt64(&m.fallback) }
+
+// DiskGuard wraps the writer and degrades predictably if the file system is low on
+// space or inodes. The actions are taken in order: deleting the oldest backups,
+// dropping the DEBUG/INFO records and switching to the fallback writer.
+type DiskGuard struct {
+	sync.Mutex
+	w         io.Writer
+	path      string
+	o         *DiskGuardOption
+	metrics   DiskGuardMetrics
+	lastCheck int64
+	low       uint32
+}
+
+// NewDiskGuard returns a DiskGuard which checks the file system of the filename written by w.
+func NewDiskGuard(w io.Writer, filename string, option *DiskGuardOption) *DiskGuard {
+	if option.checkInterval <= 0 {
+		option.checkInterval = time.Second
+	}
+
+	if option.statDisk == nil {
+		option.statDisk = statDisk
+	}
+
+	return &DiskGuard{
+		w:    w,
+		path: filename,
+		o:    option,
+	}
+}
+
+// GetMetrics returns the metrics.
+func (g *DiskGuard) GetMetrics() *DiskGuardMetrics { return &g.metrics }
+
+func (g *DiskGuard) Write(p []byte) (int, error) {
+	if !g.isLow() {
+		return g.w.Write(p)
+	}
+
+	return g.degrade(p)
+}
+
+// WriteLevel implements LevelWriter.
+func (g *DiskGuard) WriteLevel(level int8, p []byte) (int, error) {
+	if !g.isLow() {
+		return g.w.Write(p)
+	}
+
+	if g.o.dropLowLevel && level <= InfoLevel {
+		atomic.AddInt64(&g.metrics.dropped, 1)
+		return len(p), nil
+	}
+
+	return g.degrade(p)
+}
+
+// degrade switches the write to the fallback writer if it's set.
+func (g *DiskGuard) degrade(p []byte) (int, error) {
+	if g.o.fallback != nil {
+		atomic.AddInt64(&g.metrics.fallback, 1)
+		return g.o.fallback.Write(p)
+	}
+
+	return g.w.Write(p)
+}
+
+// Reopen reopens the underlying writer if it supports it.
+func (g *DiskGuard) Reopen() error {
+	if r, ok := g.w.(Reopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
+func (g *DiskGuard) Close() error {
+	if c, ok := g.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// isLow reports whether the disk is low, it checks the file system at most once per interval.
+func (g *DiskGuard) isLow() bool {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&g.lastCheck)
+	if now-last < int64(g.o.checkInterval) || !atomic.CompareAndSwapInt64(&g.lastCheck, last, now) {
+		return atomic.LoadUint32(&g.low) == 1
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	low := g.check()
+	if low && g.o.backupGlob != "" {
+		low = g.deleteBackups()
+	}
+
+	if low {
+		atomic.AddInt64(&g.metrics.lowDisk, 1)
+		atomic.StoreUint32(&g.low, 1)
+	} else {
+		atomic.StoreUint32(&g.low, 0)
+	}
+
+	return low
+}
+
+func (g *DiskGuard) check() bool {
+	st, err := g.o.statDisk(filepath.Dir(g.path))
+	if err != nil {
+		// do not degrade if we cannot know the usage
+		return false
+	}
+
+	if g.o.minFreeBytes > 0 && st.FreeBytes < g.o.minFreeBytes {
+		return true
+	}
+
+	if g.o.minFreeRatio > 0 && st.TotalBytes > 0 &&
+		float64(st.FreeBytes)/float64(st.TotalBytes) < g.o.minFreeRatio {
+		return true
+	}
+
+	if g.o.minFreeInodes > 0 && st.TotalInodes > 0 && st.FreeInodes < g.o.minFreeInodes {
+		return true
+	}
+
+	if g.o.minFreeInodeRatio > 0 && st.TotalInodes > 0 &&
+		float64(st.FreeInodes)/float64(st.TotalInodes) < g.o.minFreeInodeRatio {
+		return true
+	}
+
+	return false
+}
+
+// deleteBackups deletes the oldest backups one by one until the disk is not low.
+// It reports whether the disk is still low.
+func (g *DiskGuard) deleteBackups() bool {
+	matches, err := filepath.Glob(g.o.backupGlob)
+	if err != nil {
+		return true
+	}
+
+	// the filename may be the symlink to the current file under FilenamePattern
+	current, err := filepath.EvalSymlinks(g.path)
+	if err != nil {
+		current = g.path
+	}
+
+	type backup struct {
+		name    string
+		modTime time.Time
+	}
+
+	backups := make([]backup, 0, len(matches))
+	for _, m := range matches {
+		if g.isInUse(m, current) {
+			continue
+		}
+
+		info, err := os.Lstat(m)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		backups = append(backups, backup{name: m, modTime: info.ModTime()})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.Before(backups[j].modTime)
+	})
+
+	for i := range backups {
+		if err := os.Remove(backups[i].name); err != nil {
+			continue
+		}
+		atomic.AddInt64(&g.metrics.deletedBackups, 1)
+
+		if !g.check() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isInUse reports whether the name is the file being written or a lock file.
+func (g *DiskGuard) isInUse(name, current string) bool {
+	if strings.HasSuffix(name, ".lock") {
+		return true
+	}
+
+	name = filepath.Clean(name)
+	return name == filepath.Clean(g.path) || name == filepath.Clean(current)
+}
@@ -0,0 +1,122 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package rollingwriter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskGuardDeleteBackups(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	now := time.Now()
+	for i, name := range []string{"app.log.lock", "app.log.1", "app.log.2", "app.log.3"} {
+		fn := filepath.Join(tmpdir, name)
+		require.Nil(t, ioutil.WriteFile(fn, []byte("backup"), 0644))
+		mt := now.Add(time.Duration(i-4) * time.Hour)
+		require.Nil(t, os.Chtimes(fn, mt, mt))
+	}
+
+	// the filename links to the oldest one which is being written
+	filename := filepath.Join(tmpdir, "app.log")
+	require.Nil(t, os.Symlink("app.log.1", filename))
+
+	// every backup frees 10 bytes
+	option := NewDiskGuardOption().
+		SetMinFreeRatio(0.2).
+		SetCheckInterval(time.Hour).
+		EnableDeleteBackups(filepath.Join(tmpdir, "app.log.*"))
+	option.statDisk = func(path string) (DiskStat, error) {
+		matches, _ := filepath.Glob(filepath.Join(tmpdir, "app.log.[0-9]"))
+		return DiskStat{
+			TotalBytes:  100,
+			FreeBytes:   uint64(30 - 10*len(matches)),
+			TotalInodes: 100,
+			FreeInodes:  100,
+		}, nil
+	}
+
+	var b bytes.Buffer
+	g := NewDiskGuard(&b, filename, option)
+	_, err = g.Write([]byte("hello"))
+	require.Nil(t, err)
+	require.Equal(t, "hello", b.String())
+
+	// the current file and the lock file are kept
+	matches, err := filepath.Glob(filepath.Join(tmpdir, "app.log.*"))
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		filepath.Join(tmpdir, "app.log.1"),
+		filepath.Join(tmpdir, "app.log.lock"),
+	}, matches)
+	require.Equal(t, int64(2), g.GetMetrics().GetDeletedBackups())
+	require.Equal(t, int64(0), g.GetMetrics().GetLowDisk())
+}
+
+func TestDiskGuardDropAndFallback(t *testing.T) {
+	option := NewDiskGuardOption().
+		SetMinFreeInodes(10).
+		EnableDropLowLevel()
+	option.statDisk = func(path string) (DiskStat, error) {
+		return DiskStat{TotalBytes: 100, FreeBytes: 100, TotalInodes: 100, FreeInodes: 1}, nil
+	}
+
+	var b, fb bytes.Buffer
+	g := NewDiskGuard(&b, "", option.SetFallback(&fb))
+
+	n, err := g.WriteLevel(InfoLevel, []byte("info\n"))
+	require.Nil(t, err)
+	require.NotZero(t, n)
+	_, err = g.WriteLevel(InfoLevel-1, []byte("debug\n"))
+	require.Nil(t, err)
+	_, err = g.WriteLevel(InfoLevel+2, []byte("error\n"))
+	require.Nil(t, err)
+	// the level of Write is unknown thus it's never dropped
+	_, err = g.Write([]byte("unknown\n"))
+	require.Nil(t, err)
+
+	require.Equal(t, "", b.String())
+	require.Equal(t, "error\nunknown\n", fb.String())
+	require.Equal(t, int64(2), g.GetMetrics().GetDropped())
+	require.Equal(t, int64(2), g.GetMetrics().GetFallback())
+	require.Equal(t, int64(1), g.GetMetrics().GetLowDisk())
+}
+
+func TestBackupGlob(t *testing.T) {
+	rw := New(filepath.Join("logs[1]", "app.log"), NewOption())
+	ok, err := filepath.Match(rw.BackupGlob(), filepath.Join("logs[1]", "app-2020-01-02T03-04-05.000.log.gz"))
+	require.Nil(t, err)
+	require.True(t, ok)
+	ok, err = filepath.Match(rw.BackupGlob(), filepath.Join("logs[1]", "app.log"))
+	require.Nil(t, err)
+	require.False(t, ok)
+}
+
+func TestStatDisk(t *testing.T) {
+	st, err := statDisk(".")
+	if err != nil {
+		t.Skip(err)
+	}
+	require.True(t, st.TotalBytes >= st.FreeBytes)
+	require.True(t, st.TotalInodes >= st.FreeInodes)
+}
@@ -0,0 +1,103 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package rollingwriter
+
+import (
+	"os"
+)
+
+// LockedFileRotateWriter is a RotateWriter which is safe to share the same file among
+// multiple processes. It writes the file with O_APPEND and coordinates the rotation by
+// flock on the sidecar lock file "<filename>.lock": exactly one process renames the file
+// and the others reopen it.
+type LockedFileRotateWriter struct {
+	*FileRotateWriter
+	lockfile *os.File
+}
+
+func NewLockedFileRotateWriter(filename string) (*LockedFileRotateWriter, error) {
+	w, err := NewFileRotateWriter(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	lf, err := os.OpenFile(filename+".lock", os.O_CREATE|os.O_RDWR, os.FileMode(0644))
+	if err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+
+	return &LockedFileRotateWriter{
+		FileRotateWriter: w,
+		lockfile:         lf,
+	}, nil
+}
+
+func (w *LockedFileRotateWriter) Close() error {
+	err := w.FileRotateWriter.Close()
+	if lerr := w.lockfile.Close(); err == nil {
+		err = lerr
+	}
+	return err
+}
+
+// Rotate renames the filename to rotatename and opens a new one unless other process
+// has rotated it, in which case it only reopens the filename.
+func (w *LockedFileRotateWriter) Rotate(filename, rotatename string) error {
+	w.FileRotateWriter.Lock()
+	defer w.FileRotateWriter.Unlock()
+
+	if err := lockFile(w.lockfile); err != nil {
+		return err
+	}
+	// nolint
+	defer unlockFile(w.lockfile)
+
+	rotated := w.rotatedByOthers(filename, rotatename)
+
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	if !rotated {
+		return w.openNew(filename, rotatename)
+	}
+
+	return w.open(filename)
+}
+
+// rotatedByOthers reports whether the filename was rotated by other process, that's
+// the rotatename exists or the file we are writing is not the filename anymore.
+func (w *LockedFileRotateWriter) rotatedByOthers(filename, rotatename string) bool {
+	if _, err := os.Stat(rotatename); err == nil {
+		return true
+	}
+
+	if w.file == nil {
+		return false
+	}
+
+	cur, err := w.file.Stat()
+	if err != nil {
+		return false
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		// the filename was moved away and nobody creates a new one
+		return os.IsNotExist(err)
+	}
+
+	return !os.SameFile(cur, info)
+}
@@ -0,0 +1,202 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+// +build linux
+
+package rollingwriter
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	multiProcessFileEnv = "ROLLINGWRITER_MULTIPROCESS_FILE"
+	multiProcessIDEnv   = "ROLLINGWRITER_MULTIPROCESS_ID"
+	multiProcessPeriods = 5
+	multiProcessLines   = 200
+	// multiProcessMaxBytes overrides the maxsize of RollingWriter to rotate in tests
+	multiProcessMaxBytes = 8 * 1024
+)
+
+var multiProcessStart = time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+
+// TestLockedFileRotateWriterHelper is the child process of TestLockedFileRotateWriterMultiProcess.
+func TestLockedFileRotateWriterHelper(t *testing.T) {
+	filename := os.Getenv(multiProcessFileEnv)
+	if filename == "" {
+		t.Skip("only run as the child process")
+	}
+	id := os.Getenv(multiProcessIDEnv)
+
+	fc := &FakeClocker{}
+	trw, err := NewTimeRollingWriter(filename, &TimeRollingWriterOption{
+		TimeFormat:   DefaultTimeRollingPerSecondFormat,
+		Clocker:      fc,
+		MultiProcess: true,
+	})
+	require.Nil(t, err)
+	defer trw.Close()
+
+	for i := 0; i < multiProcessPeriods; i++ {
+		fc.SetNow(multiProcessStart.Add(time.Duration(i) * time.Second))
+		for j := 0; j < multiProcessLines; j++ {
+			_, err = trw.Write([]byte(fmt.Sprintf("%s-%d-%d\n", id, i, j)))
+			require.Nil(t, err)
+		}
+	}
+}
+
+func TestLockedFileRotateWriterMultiProcess(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "multiprocess.log")
+	f, err := os.Create(filename)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+	require.Nil(t, os.Chtimes(filename, multiProcessStart, multiProcessStart))
+
+	processes := 4
+	cmds := make([]*exec.Cmd, 0, processes)
+	for i := 0; i < processes; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestLockedFileRotateWriterHelper$")
+		cmd.Env = append(os.Environ(),
+			multiProcessFileEnv+"="+filename,
+			multiProcessIDEnv+"="+strconv.Itoa(i),
+		)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		require.Nil(t, cmd.Start())
+		cmds = append(cmds, cmd)
+	}
+
+	for i := range cmds {
+		require.Nil(t, cmds[i].Wait())
+	}
+
+	files, err := filepath.Glob(filename + "*")
+	require.Nil(t, err)
+
+	re := regexp.MustCompile(`^\d+-\d+-\d+$`)
+	seen := make(map[string]bool)
+	for _, name := range files {
+		if strings.HasSuffix(name, ".lock") {
+			continue
+		}
+		f, err := os.Open(name)
+		require.Nil(t, err)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			require.True(t, re.MatchString(line), "corrupted line %q in %s", line, name)
+			require.False(t, seen[line], "duplicated line %q", line)
+			seen[line] = true
+		}
+		require.Nil(t, scanner.Err())
+		f.Close()
+	}
+
+	require.Equal(t, processes*multiProcessPeriods*multiProcessLines, len(seen))
+}
+
+// TestRollingWriterHelper is the child process of TestRollingWriterMultiProcess.
+func TestRollingWriterHelper(t *testing.T) {
+	filename := os.Getenv(multiProcessFileEnv)
+	if filename == "" {
+		t.Skip("only run as the child process")
+	}
+	id := os.Getenv(multiProcessIDEnv)
+
+	w := New(filename, NewOption().SetMaxSize(1).EnableMultiProcess())
+	w.maxbytes = multiProcessMaxBytes
+	defer w.Close()
+
+	for i := 0; i < multiProcessPeriods; i++ {
+		for j := 0; j < multiProcessLines; j++ {
+			_, err := w.Write([]byte(fmt.Sprintf("%s-%d-%d\n", id, i, j)))
+			require.Nil(t, err)
+		}
+	}
+}
+
+func TestRollingWriterMultiProcess(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "multiprocess.log")
+
+	processes := 4
+	cmds := make([]*exec.Cmd, 0, processes)
+	for i := 0; i < processes; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestRollingWriterHelper$")
+		cmd.Env = append(os.Environ(),
+			multiProcessFileEnv+"="+filename,
+			multiProcessIDEnv+"="+strconv.Itoa(i),
+		)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		require.Nil(t, cmd.Start())
+		cmds = append(cmds, cmd)
+	}
+
+	for i := range cmds {
+		require.Nil(t, cmds[i].Wait())
+	}
+
+	files, err := filepath.Glob(filepath.Join(tmpdir, "*"))
+	require.Nil(t, err)
+
+	re := regexp.MustCompile(`^\d+-\d+-\d+$`)
+	seen := make(map[string]bool)
+	backups := 0
+	for _, name := range files {
+		if strings.HasSuffix(name, ".lock") {
+			continue
+		}
+		if name != filename {
+			// the backups are rotated only if they are full
+			info, err := os.Stat(name)
+			require.Nil(t, err)
+			require.True(t, info.Size() >= multiProcessMaxBytes, "%s is rotated early", name)
+			backups++
+		}
+		f, err := os.Open(name)
+		require.Nil(t, err)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			require.True(t, re.MatchString(line), "corrupted line %q in %s", line, name)
+			require.False(t, seen[line], "duplicated line %q", line)
+			seen[line] = true
+		}
+		require.Nil(t, scanner.Err())
+		f.Close()
+	}
+
+	require.True(t, backups > 0)
+	require.Equal(t, processes*multiProcessPeriods*multiProcessLines, len(seen))
+}
@@ -0,0 +1,138 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package rollingwriter
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Reopener reopens the underlying file of writer.
+type Reopener interface {
+	Reopen() error
+}
+
+var (
+	_ Reopener = (*FileRotateWriter)(nil)
+	_ Reopener = (*TimeRollingWriter)(nil)
+	_ Reopener = (*RollingWriter)(nil)
+)
+
+// Watcher watches the inode of filename and reopens the writer once
+// the file was removed or replaced (e.g. moved away by logrotate).
+type Watcher struct {
+	sync.Mutex
+	filename string
+	interval time.Duration
+	r        Reopener
+	last     os.FileInfo
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+// NewWatcher returns a new watcher which checks the filename every interval (default 1s).
+func NewWatcher(filename string, r Reopener, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	w := &Watcher{
+		filename: filename,
+		interval: interval,
+		r:        r,
+	}
+	// nolint
+	w.last, _ = os.Stat(filename)
+
+	return w
+}
+
+// Start starts a goroutine to check the filename periodically.
+func (w *Watcher) Start() {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.stopCh != nil {
+		return
+	}
+	w.stopCh = make(chan struct{})
+	w.doneCh = make(chan struct{})
+
+	go w.watch(w.stopCh, w.doneCh)
+}
+
+// Stop stops the watching goroutine and waits for it exits.
+func (w *Watcher) Stop() {
+	w.Lock()
+	stopCh, doneCh := w.stopCh, w.doneCh
+	w.stopCh, w.doneCh = nil, nil
+	w.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+func (w *Watcher) watch(stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			// nolint
+			w.Check()
+		}
+	}
+}
+
+// Check reopens the writer if the filename disappears or is replaced.
+// It reports whether the writer was reopened.
+func (w *Watcher) Check() (bool, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	info, err := os.Stat(w.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if w.last == nil { // the writer does not create the file yet
+		w.last = info
+		return false, nil
+	}
+
+	if info != nil && os.SameFile(w.last, info) {
+		return false, nil
+	}
+
+	if err = w.r.Reopen(); err != nil {
+		return false, err
+	}
+
+	info, err = os.Stat(w.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return true, err
+	}
+	w.last = info
+
+	return true, nil
+}
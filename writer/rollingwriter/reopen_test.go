@@ -0,0 +1,112 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package rollingwriter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileRotateWriterReopen(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "reopen.log")
+	w, err := NewFileRotateWriter(filename)
+	require.Nil(t, err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("hello"))
+	require.Nil(t, err)
+
+	// move the file away like logrotate
+	require.Nil(t, os.Rename(filename, filename+".1"))
+	_, err = w.Write([]byte(" world"))
+	require.Nil(t, err)
+
+	require.Nil(t, w.Reopen())
+	_, err = w.Write([]byte("again"))
+	require.Nil(t, err)
+
+	cc, err := ioutil.ReadFile(filename + ".1")
+	require.Nil(t, err)
+	require.Equal(t, "hello world", string(cc))
+
+	cc, err = ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	require.Equal(t, "again", string(cc))
+}
+
+func TestFileRotateWriterCopyTruncate(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "truncate.log")
+	w, err := NewFileRotateWriter(filename)
+	require.Nil(t, err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("hello"))
+	require.Nil(t, err)
+	require.Nil(t, os.Truncate(filename, 0))
+	_, err = w.Write([]byte("world"))
+	require.Nil(t, err)
+
+	cc, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	require.Equal(t, "world", string(cc))
+}
+
+func TestWatcher(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "watch.log")
+	w, err := NewFileRotateWriter(filename)
+	require.Nil(t, err)
+	defer w.Close()
+
+	watcher := NewWatcher(filename, w, time.Millisecond)
+	reopened, err := watcher.Check()
+	require.Nil(t, err)
+	require.False(t, reopened)
+
+	require.Nil(t, os.Rename(filename, filename+".1"))
+	reopened, err = watcher.Check()
+	require.Nil(t, err)
+	require.True(t, reopened)
+
+	require.Nil(t, os.Remove(filename))
+	watcher.Start()
+	defer watcher.Stop()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filename)
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	_, err = w.Write([]byte("hello"))
+	require.Nil(t, err)
+	cc, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(cc))
+}
@@ -13,14 +13,27 @@
 
 package rollingwriter
 
-import "github.com/natefinch/lumberjack"
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/natefinch/lumberjack"
+	"github.com/sofastack/sofa-common-go/syncpool/bytespool"
+	"github.com/sofastack/sofa-common-go/writer/framer"
+)
 
 type Option struct {
-	maxsize    int
-	maxbackups int
-	maxAge     int
-	localTime  bool
-	compress   bool
+	maxsize      int
+	maxbackups   int
+	maxAge       int
+	localTime    bool
+	compress     bool
+	multiProcess bool
+	framer       framer.LineFramer
 }
 
 func NewOption() *Option {
@@ -33,12 +46,39 @@ func (o *Option) SetMaxAge(i int) *Option     { o.maxAge = i; return o }
 func (o *Option) EnableLocalTime() *Option    { o.localTime = true; return o }
 func (o *Option) EnableCompress() *Option     { o.compress = true; return o }
 
+// EnableMultiProcess makes the file safe to share among multiple processes, see RollingWriter.
+// It's exclusive with EnableCompress.
+func (o *Option) EnableMultiProcess() *Option { o.multiProcess = true; return o }
+
+// SetLineFramer sets the framer which frames every record before writing.
+func (o *Option) SetLineFramer(f framer.LineFramer) *Option { o.framer = f; return o }
+
+// ErrCompressUnsupported indicates the compress is enabled under multi-process mode, it's
+// unsupported since the backup may be compressed before the others stop writing it.
+var ErrCompressUnsupported = errors.New("rollingwriter: compress is unsupported under multi-process")
+
+// defaultMaxSize is the default maxsize of lumberjack in megabytes.
+const defaultMaxSize = 100
+
+// RollingWriter rotates the file by size.
+//
+// In multi-process mode the processes append to the same file and decide the rotation
+// by the size of the file instead of the bytes written by themselves. The rotation is
+// coordinated by flock on the sidecar lock file "<filename>.lock": exactly one process
+// renames the file and the others reopen it on their next write. It costs a stat per write.
 type RollingWriter struct {
 	logger *lumberjack.Logger
+	framer framer.LineFramer
+
+	multiProcess bool
+	mu           sync.Mutex
+	maxbytes     int64
+	lockfile     *os.File
+	current      os.FileInfo // the file being written, nil means the next write opens it
 }
 
 func New(filename string, option *Option) *RollingWriter {
-	return &RollingWriter{
+	rw := &RollingWriter{
 		logger: &lumberjack.Logger{
 			Filename:   filename,
 			MaxSize:    option.maxsize,
@@ -47,13 +87,209 @@ func New(filename string, option *Option) *RollingWriter {
 			LocalTime:  option.localTime,
 			Compress:   option.compress,
 		},
+		framer:       option.framer,
+		multiProcess: option.multiProcess,
 	}
+
+	if rw.multiProcess {
+		maxsize := option.maxsize
+		if maxsize <= 0 {
+			maxsize = defaultMaxSize
+		}
+		rw.maxbytes = int64(maxsize) * 1024 * 1024
+		// lumberjack never rotates by itself since it only counts the bytes of this process
+		rw.logger.MaxSize = math.MaxInt32
+	}
+
+	return rw
 }
 
 func (rw *RollingWriter) Write(b []byte) (int, error) {
-	return rw.logger.Write(b)
+	if rw.framer == nil {
+		return rw.write(b)
+	}
+
+	fb := bytespool.AcquireBytes()
+	*fb = rw.framer.Frame((*fb)[:0], b, time.Now())
+	_, err := rw.write(*fb)
+	bytespool.ReleaseBytes(fb)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
 }
 
-func (rw *RollingWriter) Close() error {
+func (rw *RollingWriter) write(p []byte) (int, error) {
+	if !rw.multiProcess {
+		return rw.logger.Write(p)
+	}
+
+	if rw.logger.Compress {
+		return 0, ErrCompressUnsupported
+	}
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.current != nil {
+		info, err := os.Stat(rw.logger.Filename)
+		if err != nil || !os.SameFile(info, rw.current) {
+			// rotated by others
+			if err = rw.closeCurrent(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if rw.current == nil {
+		if err := rw.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rw.logger.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	return n, rw.tryRotate()
+}
+
+// open opens the filename under the flock, thus the file we stat is the file lumberjack opens.
+func (rw *RollingWriter) open() error {
+	if err := rw.lock(); err != nil {
+		return err
+	}
+	// nolint
+	defer unlockFile(rw.lockfile)
+
+	return rw.openAppend()
+}
+
+// openAppend opens the filename by lumberjack in append mode, it must be called under the flock.
+func (rw *RollingWriter) openAppend() error {
+	if err := rw.closeCurrent(); err != nil {
+		return err
+	}
+
+	// lumberjack creates the new file without O_APPEND thus the writes of the processes
+	// overwrite each other, create it first to make lumberjack open the existing one.
+	f, err := openFile(rw.logger.Filename, os.FileMode(0644))
+	if err != nil {
+		return err
+	}
+	// nolint
+	f.Close()
+
+	// lumberjack opens the file lazily on write
+	if _, err = rw.logger.Write(nil); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(rw.logger.Filename)
+	if err != nil {
+		return err
+	}
+	rw.current = info
+
+	return nil
+}
+
+// tryRotate rotates the file if it's full and still the filename, or reopens the
+// filename if other process has rotated it.
+func (rw *RollingWriter) tryRotate() error {
+	info, err := os.Stat(rw.logger.Filename)
+	if err == nil && os.SameFile(info, rw.current) && info.Size() < rw.maxbytes {
+		return nil
+	}
+
+	if err = rw.lock(); err != nil {
+		return err
+	}
+	// nolint
+	defer unlockFile(rw.lockfile)
+
+	info, err = os.Stat(rw.logger.Filename)
+	if err != nil || !os.SameFile(info, rw.current) {
+		return rw.closeCurrent()
+	}
+
+	if info.Size() < rw.maxbytes {
+		return nil
+	}
+
+	if err = rw.logger.Rotate(); err != nil {
+		return err
+	}
+
+	if err = rw.openAppend(); err != nil {
+		return err
+	}
+
+	// lumberjack names the backups in milliseconds, hold the lock a millisecond
+	// thus the next rotation never overwrites this backup.
+	time.Sleep(time.Millisecond)
+
+	return nil
+}
+
+// lock acquires the flock and opens the lock file at first.
+func (rw *RollingWriter) lock() error {
+	if rw.lockfile == nil {
+		// nolint
+		if err := os.MkdirAll(filepath.Dir(rw.logger.Filename), 0755); err != nil {
+			return err
+		}
+
+		lf, err := os.OpenFile(rw.logger.Filename+".lock", os.O_CREATE|os.O_RDWR, os.FileMode(0644))
+		if err != nil {
+			return err
+		}
+		rw.lockfile = lf
+	}
+
+	return lockFile(rw.lockfile)
+}
+
+func (rw *RollingWriter) closeCurrent() error {
+	rw.current = nil
 	return rw.logger.Close()
 }
+
+// BackupGlob returns the glob pattern which matches the backups named by lumberjack,
+// e.g. "app-2006-01-02T15-04-05.000.log" and its compressed one of "app.log".
+func (rw *RollingWriter) BackupGlob() string {
+	dir, base := filepath.Split(rw.logger.Filename)
+	ext := filepath.Ext(base)
+	return globQuote(dir) + globQuote(base[:len(base)-len(ext)]) + "-*" + globQuote(ext) + "*"
+}
+
+// Reopen closes the current file and the next write opens the filename again.
+func (rw *RollingWriter) Reopen() error {
+	if !rw.multiProcess {
+		return rw.logger.Close()
+	}
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.closeCurrent()
+}
+
+func (rw *RollingWriter) Close() error {
+	if !rw.multiProcess {
+		return rw.logger.Close()
+	}
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	err := rw.closeCurrent()
+	if rw.lockfile != nil {
+		if lerr := rw.lockfile.Close(); err == nil {
+			err = lerr
+		}
+		rw.lockfile = nil
+	}
+	return err
+}
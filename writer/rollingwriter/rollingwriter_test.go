@@ -34,3 +34,14 @@ func TestRollingWriter(t *testing.T) {
 	require.Equal(t, "abcd", string(cc))
 	w.Close()
 }
+
+func TestRollingWriterMultiProcessCompress(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testdata")
+	require.Nil(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	w := New(tmpfile.Name(), NewOption().EnableCompress().EnableMultiProcess())
+	_, err = w.Write([]byte("abcd"))
+	require.Equal(t, ErrCompressUnsupported, err)
+	require.Nil(t, w.Close())
+}
@@ -18,6 +18,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
 const (
@@ -33,7 +34,9 @@ type RotateWriter interface {
 }
 
 type FileRotateWriter struct {
-	file *os.File
+	sync.Mutex
+	filename string
+	file     *os.File
 }
 
 func NewFileRotateWriter(filename string) (*FileRotateWriter, error) {
@@ -42,18 +45,30 @@ func NewFileRotateWriter(filename string) (*FileRotateWriter, error) {
 		return nil, err
 	}
 
-	// TODO: add the truncate flag?
-	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, os.FileMode(0644))
+	f, err := openFile(filename, os.FileMode(0644))
 	if err != nil {
 		return nil, err
 	}
 
 	return &FileRotateWriter{
-		file: f,
+		filename: filename,
+		file:     f,
 	}, nil
 }
 
+// openFile opens the filename in append mode thus the writes always land at
+// the end of file even if the file was truncated by others (e.g. logrotate copytruncate).
+func openFile(filename string, mode os.FileMode) (*os.File, error) {
+	return os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, mode)
+}
+
 func (w *FileRotateWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	return w.close()
+}
+
+func (w *FileRotateWriter) close() error {
 	if w.file == nil {
 		return nil
 	}
@@ -63,6 +78,9 @@ func (w *FileRotateWriter) Close() error {
 }
 
 func (w *FileRotateWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
 	if w.file == nil {
 		return 0, fmt.Errorf("no available file")
 	}
@@ -71,7 +89,10 @@ func (w *FileRotateWriter) Write(p []byte) (int, error) {
 }
 
 func (w *FileRotateWriter) Rotate(filename, rotatename string) error {
-	if err := w.Close(); err != nil {
+	w.Lock()
+	defer w.Unlock()
+
+	if err := w.close(); err != nil {
 		return err
 	}
 
@@ -82,6 +103,47 @@ func (w *FileRotateWriter) Rotate(filename, rotatename string) error {
 	return nil
 }
 
+// Reopen closes the current file and opens the filename again without renaming.
+// It's useful when the file was moved or removed by others.
+func (w *FileRotateWriter) Reopen() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	return w.open(w.filename)
+}
+
+// Open closes the current file and opens the filename.
+func (w *FileRotateWriter) Open(filename string) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	return w.open(filename)
+}
+
+func (w *FileRotateWriter) open(filename string) error {
+	// nolint
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	f, err := openFile(filename, os.FileMode(0644))
+	if err != nil {
+		return err
+	}
+	w.filename = filename
+	w.file = f
+
+	return nil
+}
+
 func (w *FileRotateWriter) openNew(filename, rotatename string) error {
 	// 0755 is safe to logging
 	// nolint
@@ -106,11 +168,11 @@ func (w *FileRotateWriter) openNew(filename, rotatename string) error {
 		}
 	}
 
-	// TODO: add the truncate flag?
-	f, ferr := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, mode)
+	f, ferr := openFile(filename, mode)
 	if ferr != nil {
 		return ferr
 	}
+	w.filename = filename
 	w.file = f
 
 	return nil
@@ -0,0 +1,218 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package rollingwriter
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type strftimeSegment struct {
+	literal string
+	verb    byte
+}
+
+// strftimePattern formats the time in strftime(3) style, e.g. "app.log.%Y-%m-%d_%H".
+type strftimePattern struct {
+	pattern  string
+	segments []strftimeSegment
+}
+
+// compileStrftime compiles the pattern, unknown verbs are kept as is.
+func compileStrftime(pattern string) *strftimePattern {
+	sp := &strftimePattern{pattern: pattern}
+
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			sp.segments = append(sp.segments, strftimeSegment{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '%' || i == len(pattern)-1 {
+			literal.WriteByte(c)
+			continue
+		}
+
+		i++
+		verb := pattern[i]
+		switch verb {
+		case 'A', 'a', 'B', 'b', 'C', 'c', 'D', 'd', 'e', 'F', 'H', 'h', 'I', 'j', 'k', 'l',
+			'M', 'm', 'p', 'R', 'r', 'S', 'T', 'u', 'w', 'y', 'Y', 'Z', 'z':
+			flush()
+			sp.segments = append(sp.segments, strftimeSegment{verb: verb})
+		case 'n':
+			literal.WriteByte('\n')
+		case 't':
+			literal.WriteByte('\t')
+		case '%':
+			literal.WriteByte('%')
+		default:
+			literal.WriteByte('%')
+			literal.WriteByte(verb)
+		}
+	}
+	flush()
+
+	return sp
+}
+
+// AppendFormat appends the formatted t to dst.
+func (sp *strftimePattern) AppendFormat(dst []byte, t time.Time) []byte {
+	for i := range sp.segments {
+		seg := &sp.segments[i]
+		if seg.verb == 0 {
+			dst = append(dst, seg.literal...)
+			continue
+		}
+		dst = appendStrftimeVerb(dst, seg.verb, t)
+	}
+	return dst
+}
+
+// Format returns the formatted t.
+func (sp *strftimePattern) Format(t time.Time) string {
+	return string(sp.AppendFormat(nil, t))
+}
+
+// Glob returns the glob pattern which matches all the formatted filenames, the meta
+// characters of the literals are escaped.
+func (sp *strftimePattern) Glob() string {
+	var b strings.Builder
+	for i := range sp.segments {
+		seg := &sp.segments[i]
+		if seg.verb == 0 {
+			globEscape(&b, seg.literal)
+		} else {
+			b.WriteByte('*')
+		}
+	}
+	return b.String()
+}
+
+// globEscape writes s escaped for filepath.Match, the backslash is the path separator
+// rather than the escape on windows thus the meta characters are escaped by class.
+func globEscape(b *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '?', '[':
+			b.WriteByte('[')
+			b.WriteByte(c)
+			b.WriteByte(']')
+		case '\\':
+			if runtime.GOOS != "windows" {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// globQuote returns s escaped for filepath.Match.
+func globQuote(s string) string {
+	var b strings.Builder
+	globEscape(&b, s)
+	return b.String()
+}
+
+func appendInt(dst []byte, i int, width int, pad byte) []byte {
+	var b [20]byte
+	s := strconv.AppendInt(b[:0], int64(i), 10)
+	for j := len(s); j < width; j++ {
+		dst = append(dst, pad)
+	}
+	return append(dst, s...)
+}
+
+func appendStrftimeVerb(dst []byte, verb byte, t time.Time) []byte {
+	switch verb {
+	case 'A':
+		return append(dst, t.Weekday().String()...)
+	case 'a':
+		return append(dst, t.Weekday().String()[:3]...)
+	case 'B':
+		return append(dst, t.Month().String()...)
+	case 'b', 'h':
+		return append(dst, t.Month().String()[:3]...)
+	case 'C':
+		return appendInt(dst, t.Year()/100, 2, '0')
+	case 'c':
+		return t.AppendFormat(dst, "Mon Jan _2 15:04:05 2006")
+	case 'D':
+		return t.AppendFormat(dst, "01/02/06")
+	case 'd':
+		return appendInt(dst, t.Day(), 2, '0')
+	case 'e':
+		return appendInt(dst, t.Day(), 2, ' ')
+	case 'F':
+		return t.AppendFormat(dst, "2006-01-02")
+	case 'H':
+		return appendInt(dst, t.Hour(), 2, '0')
+	case 'I':
+		return appendInt(dst, hour12(t), 2, '0')
+	case 'j':
+		return appendInt(dst, t.YearDay(), 3, '0')
+	case 'k':
+		return appendInt(dst, t.Hour(), 2, ' ')
+	case 'l':
+		return appendInt(dst, hour12(t), 2, ' ')
+	case 'M':
+		return appendInt(dst, t.Minute(), 2, '0')
+	case 'm':
+		return appendInt(dst, int(t.Month()), 2, '0')
+	case 'p':
+		return t.AppendFormat(dst, "PM")
+	case 'R':
+		return t.AppendFormat(dst, "15:04")
+	case 'r':
+		return t.AppendFormat(dst, "03:04:05 PM")
+	case 'S':
+		return appendInt(dst, t.Second(), 2, '0')
+	case 'T':
+		return t.AppendFormat(dst, "15:04:05")
+	case 'u':
+		wd := int(t.Weekday())
+		if wd == 0 {
+			wd = 7
+		}
+		return appendInt(dst, wd, 1, '0')
+	case 'w':
+		return appendInt(dst, int(t.Weekday()), 1, '0')
+	case 'y':
+		return appendInt(dst, t.Year()%100, 2, '0')
+	case 'Y':
+		return appendInt(dst, t.Year(), 4, '0')
+	case 'Z':
+		return t.AppendFormat(dst, "MST")
+	case 'z':
+		return t.AppendFormat(dst, "-0700")
+	default:
+		return append(dst, '%', verb)
+	}
+}
+
+func hour12(t time.Time) int {
+	h := t.Hour() % 12
+	if h == 0 {
+		h = 12
+	}
+	return h
+}
@@ -0,0 +1,61 @@
+// nolint
+// Copyright 20xx The Alipay Authors.
+//
+// @authors[0]: bingwu.ybw(bingwu.ybw@antfin.com|detailyang@gmail.com)
+// @authors[1]: robotx(robotx@antfin.com)
+//
+// *Legal Disclaimer*
+// Within this source code, the comments in Chinese shall be the original, governing version. Any comment in other languages are for reference only. In the event of any conflict between the Chinese language version comments and other language version comments, the Chinese language version shall prevail.
+// *法律免责声明*
+// 关于代码注释部分，中文注释为官方版本，其它语言注释仅做参考。中文注释可能与其它语言注释存在不一致，当中文注释与其它语言注释存在不一致时，请以中文注释为准。
+//
+//
+
+package rollingwriter
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrftime(t *testing.T) {
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	cases := []struct {
+		pattern string
+		expect  string
+		glob    string
+	}{
+		{"app.log.%Y-%m-%d_%H", "app.log.2020-01-02_15", "app.log.*-*-*_*"},
+		{"app.log.%Y%m%d%H%M%S", "app.log.20200102150405", "app.log.******"},
+		{"%F %T", "2020-01-02 15:04:05", "* *"},
+		{"%y %j %I%p %e %a %b", "20 002 03PM  2 Thu Jan", "* * ** * * *"},
+		{"100%% %q", "100% %q", "100% %q"},
+		{"trailing%", "trailing%", "trailing%"},
+		{"app[1]*?.log.%H", "app[1]*?.log.15", "app[[]1][*][?].log.*"},
+	}
+
+	for i, c := range cases {
+		sp := compileStrftime(c.pattern)
+		require.Equal(t, c.expect, sp.Format(now), "case %d", i)
+		require.Equal(t, c.glob, sp.Glob(), "case %d", i)
+
+		ok, err := filepath.Match(sp.Glob(), c.expect)
+		require.Nil(t, err, "case %d", i)
+		require.True(t, ok, "case %d", i)
+	}
+
+	// the backslash is escaped except on windows where it's the path separator
+	sp := compileStrftime(`a\b.%H`)
+	if runtime.GOOS == "windows" {
+		require.Equal(t, `a\b.*`, sp.Glob())
+	} else {
+		require.Equal(t, `a\\b.*`, sp.Glob())
+		ok, err := filepath.Match(sp.Glob(), `a\b.15`)
+		require.Nil(t, err)
+		require.True(t, ok)
+	}
+}
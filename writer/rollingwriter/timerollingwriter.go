@@ -15,16 +15,33 @@ package rollingwriter
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/sofastack/sofa-common-go/writer/framer"
 )
 
 const (
 	DefaultTimeFormat = `2006-01-02T15-04-05.000`
 )
 
+// ErrFileOpenerRequired indicates the RotateWriter cannot open the file named by FilenamePattern.
+var ErrFileOpenerRequired = errors.New("rollingwriter: RotateWriter must implement FileOpener with FilenamePattern")
+
+// ErrMultiProcessUnsupported indicates MultiProcess is set with a RotateWriter which
+// cannot be coordinated among processes.
+var ErrMultiProcessUnsupported = errors.New("rollingwriter: MultiProcess is unsupported with RotateWriter")
+
+// FileOpener opens another file to write.
+type FileOpener interface {
+	Open(filename string) error
+}
+
 type TimeRollingNamer interface {
 	Name(filename string, timeformat string, now time.Time) string
 }
@@ -40,11 +57,27 @@ var DefaultTimeRollingNamer = TimeRollingNamerFunc(func(filename string, timefor
 })
 
 type TimeRollingWriterOption struct {
-	TimeFormat       string
-	Clocker          Clocker
+	TimeFormat string
+	Clocker    Clocker
+	// Deprecated: use LineFramer with framer.TimePrefix and framer.Newline instead.
 	AppendTimeHeader bool
+	// LineFramer frames every record before writing if it's not nil.
+	LineFramer       framer.LineFramer
 	RotateWriter     RotateWriter
 	TimeRollingNamer TimeRollingNamer
+	// MultiProcess uses the LockedFileRotateWriter thus the file can be shared among
+	// multiple processes, it's exclusive with RotateWriter. With FilenamePattern the
+	// symlink swapping and the removing of expired files are serialized by flock instead.
+	MultiProcess bool
+	// FilenamePattern is the strftime(3) style pattern e.g. "/home/admin/logs/app.log.%Y-%m-%d_%H".
+	// If it's set, the records are written to the file named by the pattern directly instead of
+	// renaming and the filename is updated as a symlink to the current file.
+	FilenamePattern string
+	// RotationTime truncates the time on its local wall clock before formatting the
+	// FilenamePattern if it's set, e.g. 24h rolls at the local midnight.
+	RotationTime time.Duration
+	// MaxAge removes the files matched the FilenamePattern which are older than it if it's set.
+	MaxAge time.Duration
 }
 
 type TimeRollingWriter struct {
@@ -58,8 +91,11 @@ type TimeRollingWriter struct {
 		lasttimeb []byte
 		nowtimeb  []byte
 	}
-	rw  RotateWriter
-	trn TimeRollingNamer
+	rw       RotateWriter
+	trn      TimeRollingNamer
+	framer   framer.LineFramer
+	pattern  *strftimePattern
+	lockfile *os.File // only used with FilenamePattern under MultiProcess
 }
 
 func NewTimeRollingWriter(filename string, option *TimeRollingWriterOption) (*TimeRollingWriter, error) {
@@ -69,10 +105,15 @@ func NewTimeRollingWriter(filename string, option *TimeRollingWriterOption) (*Ti
 		c:        option.Clocker,
 		rw:       option.RotateWriter,
 		trn:      option.TimeRollingNamer,
+		framer:   option.LineFramer,
 	}
 
 	var err error
 
+	if trw.o.MultiProcess && trw.rw != nil {
+		return nil, ErrMultiProcessUnsupported
+	}
+
 	if trw.o.TimeFormat == "" {
 		trw.o.TimeFormat = DefaultTimeRollingPerHourFormat
 	}
@@ -85,8 +126,27 @@ func NewTimeRollingWriter(filename string, option *TimeRollingWriterOption) (*Ti
 		trw.trn = DefaultTimeRollingNamer
 	}
 
+	if trw.framer == nil && trw.o.AppendTimeHeader {
+		trw.framer = framer.Chain(framer.TimePrefix(DefaultTimeFormat), framer.Newline())
+	}
+
+	if trw.o.FilenamePattern != "" {
+		if err = trw.initPattern(); err != nil {
+			if trw.lockfile != nil {
+				// nolint
+				trw.lockfile.Close()
+			}
+			return nil, err
+		}
+		return trw, nil
+	}
+
 	if trw.rw == nil {
-		trw.rw, err = NewFileRotateWriter(filename)
+		if trw.o.MultiProcess {
+			trw.rw, err = NewLockedFileRotateWriter(filename)
+		} else {
+			trw.rw, err = NewFileRotateWriter(filename)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -112,17 +172,188 @@ func (trw *TimeRollingWriter) Write(p []byte) (int, error) {
 		return 0, err
 	}
 
-	if trw.o.AppendTimeHeader {
-		trw.b = now.AppendFormat(trw.b[:0], DefaultTimeFormat)
-		trw.b = append(trw.b, ' ')
-		trw.b = append(trw.b, p...)
-		trw.b = append(trw.b, '\n')
-		return trw.rw.Write(trw.b)
+	if trw.framer != nil {
+		trw.b = trw.framer.Frame(trw.b[:0], p, now)
+		if _, err := trw.rw.Write(trw.b); err != nil {
+			return 0, err
+		}
+		return len(p), nil
 	}
 	return trw.rw.Write(p)
 }
 
+// initPattern opens the file named by the pattern, the writes do not need the lock
+// even if it's shared among processes because there is no renaming.
+func (trw *TimeRollingWriter) initPattern() error {
+	trw.pattern = compileStrftime(trw.o.FilenamePattern)
+
+	if trw.o.MultiProcess {
+		// nolint
+		if err := os.MkdirAll(filepath.Dir(trw.filename), 0755); err != nil {
+			return err
+		}
+		lf, err := os.OpenFile(trw.filename+".lock", os.O_CREATE|os.O_RDWR, os.FileMode(0644))
+		if err != nil {
+			return err
+		}
+		trw.lockfile = lf
+	}
+
+	now := trw.c.Now()
+	trw.timing.lasttime = now
+	trw.timing.lasttimeb = trw.formatPattern(trw.timing.lasttimeb[:0], now)
+	name := string(trw.timing.lasttimeb)
+
+	if trw.rw == nil {
+		rw, err := NewFileRotateWriter(name)
+		if err != nil {
+			return err
+		}
+		trw.rw = rw
+
+	} else {
+		fo, ok := trw.rw.(FileOpener)
+		if !ok {
+			return ErrFileOpenerRequired
+		}
+		if err := fo.Open(name); err != nil {
+			return err
+		}
+	}
+
+	return trw.link(name)
+}
+
+// lock serializes the symlink swapping and the removing among processes under MultiProcess.
+func (trw *TimeRollingWriter) lock() (func(), error) {
+	if trw.lockfile == nil {
+		return func() {}, nil
+	}
+
+	if err := lockFile(trw.lockfile); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		// nolint
+		unlockFile(trw.lockfile)
+	}, nil
+}
+
+func (trw *TimeRollingWriter) formatPattern(dst []byte, now time.Time) []byte {
+	if trw.o.RotationTime > 0 {
+		now = truncateTime(now, trw.o.RotationTime)
+	}
+	return trw.pattern.AppendFormat(dst, now)
+}
+
+// truncateTime truncates now on the wall clock of its location like rotatelogs did,
+// e.g. the daily files roll at the local midnight instead of the UTC one.
+func truncateTime(now time.Time, d time.Duration) time.Time {
+	if now.Location() == time.UTC {
+		return now.Truncate(d)
+	}
+
+	base := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(),
+		now.Second(), now.Nanosecond(), time.UTC).Truncate(d)
+	return time.Date(base.Year(), base.Month(), base.Day(), base.Hour(), base.Minute(),
+		base.Second(), base.Nanosecond(), now.Location())
+}
+
+// link points the filename to the current file atomically.
+func (trw *TimeRollingWriter) link(name string) error {
+	unlock, err := trw.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	target := name
+	if filepath.Dir(name) == filepath.Dir(trw.filename) {
+		target = filepath.Base(name)
+	}
+
+	// the temporary name is unique thus the writers sharing the filename never collide
+	tmp := fmt.Sprintf("%s_symlink.%d.%d", trw.filename, os.Getpid(), rand.Uint32())
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, trw.filename); err != nil {
+		// nolint
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// removeExpired removes the files matched the pattern which are older than MaxAge.
+func (trw *TimeRollingWriter) removeExpired(now time.Time, current string) error {
+	if trw.o.MaxAge <= 0 {
+		return nil
+	}
+
+	unlock, err := trw.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	matches, err := filepath.Glob(trw.pattern.Glob())
+	if err != nil {
+		return err
+	}
+
+	// the lock file coordinates the processes by its inode thus it's never removed
+	lockname := filepath.Clean(trw.filename + ".lock")
+
+	cutoff := now.Add(-trw.o.MaxAge)
+	for _, m := range matches {
+		if m == current || m == trw.filename || filepath.Clean(m) == lockname {
+			continue
+		}
+
+		info, err := os.Lstat(m)
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+
+		if info.ModTime().Before(cutoff) {
+			// nolint
+			os.Remove(m)
+		}
+	}
+
+	return nil
+}
+
+func (trw *TimeRollingWriter) tryRotatePattern(now time.Time) error {
+	trw.timing.nowtimeb = trw.formatPattern(trw.timing.nowtimeb[:0], now)
+	if bytes.Equal(trw.timing.nowtimeb, trw.timing.lasttimeb) {
+		return nil
+	}
+
+	name := string(trw.timing.nowtimeb)
+	trw.timing.lasttimeb = append(trw.timing.lasttimeb[:0], trw.timing.nowtimeb...)
+	trw.timing.lasttime = now
+
+	if err := trw.rw.(FileOpener).Open(name); err != nil {
+		return err
+	}
+
+	if err := trw.link(name); err != nil {
+		return err
+	}
+
+	return trw.removeExpired(now, name)
+}
+
 func (trw *TimeRollingWriter) tryRotate(now time.Time) error {
+	if trw.pattern != nil {
+		return trw.tryRotatePattern(now)
+	}
+
 	trw.timing.nowtimeb = now.AppendFormat(trw.timing.nowtimeb[:0], trw.o.TimeFormat)
 	if !bytes.Equal(trw.timing.nowtimeb, trw.timing.lasttimeb) {
 		rotatename := trw.trn.Name(trw.filename, trw.o.TimeFormat, trw.timing.lasttime)
@@ -133,6 +364,32 @@ func (trw *TimeRollingWriter) tryRotate(now time.Time) error {
 	return nil
 }
 
+// BackupGlob returns the glob pattern which matches the files named by the FilenamePattern,
+// or the backups named by the default TimeRollingNamer.
+func (trw *TimeRollingWriter) BackupGlob() string {
+	if trw.pattern != nil {
+		return trw.pattern.Glob()
+	}
+	return globQuote(trw.filename) + ".*"
+}
+
+// Reopen reopens the underlying file if the RotateWriter supports it.
+func (trw *TimeRollingWriter) Reopen() error {
+	trw.Lock()
+	defer trw.Unlock()
+
+	if r, ok := trw.rw.(Reopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
 func (trw *TimeRollingWriter) Close() error {
-	return trw.rw.Close()
+	err := trw.rw.Close()
+	if trw.lockfile != nil {
+		if lerr := trw.lockfile.Close(); err == nil {
+			err = lerr
+		}
+	}
+	return err
 }
@@ -16,6 +16,7 @@ package rollingwriter
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -55,3 +56,184 @@ func TestTimeRollingWriter(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, count, len(files))
 }
+
+func TestTimeRollingWriterLineFramer(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "framer.log")
+	fc := &FakeClocker{}
+	fc.SetNow(time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local))
+
+	trw, err := NewTimeRollingWriter(filename, &TimeRollingWriterOption{
+		Clocker:          fc,
+		AppendTimeHeader: true,
+	})
+	require.Nil(t, err)
+	defer trw.Close()
+
+	n, err := trw.Write([]byte("hello\n"))
+	require.Nil(t, err)
+	require.Equal(t, 6, n)
+	n, err = trw.Write([]byte("world"))
+	require.Nil(t, err)
+	require.Equal(t, 5, n)
+
+	cc, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	require.Equal(t, "2020-01-02T03-04-05.000 hello\n2020-01-02T03-04-05.000 world\n", string(cc))
+}
+
+func TestTimeRollingWriterFilenamePattern(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "pattern.log")
+	fc := &FakeClocker{}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	fc.SetNow(now)
+
+	trw, err := NewTimeRollingWriter(filename, &TimeRollingWriterOption{
+		Clocker:         fc,
+		FilenamePattern: filepath.Join(tmpdir, "pattern.log.%Y-%m-%d_%H"),
+		RotationTime:    time.Hour,
+		MaxAge:          24 * time.Hour,
+	})
+	require.Nil(t, err)
+	defer trw.Close()
+
+	for i := 0; i < 3; i++ {
+		fc.SetNow(now.Add(time.Duration(i) * time.Hour))
+		_, err = trw.Write([]byte("hello"))
+		require.Nil(t, err)
+
+		link, err := os.Readlink(filename)
+		require.Nil(t, err)
+		require.Equal(t, "pattern.log.2020-01-02_0"+string(rune('3'+i)), link)
+
+		cc, err := ioutil.ReadFile(filename)
+		require.Nil(t, err)
+		require.Equal(t, "hello", string(cc))
+	}
+
+	files, err := filepath.Glob(filepath.Join(tmpdir, "pattern.log.*"))
+	require.Nil(t, err)
+	require.Equal(t, 3, len(files))
+
+	// the temporary symlinks are renamed to the filename
+	files, err = filepath.Glob(filename + "_symlink*")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(files))
+
+	// all files are older than MaxAge since the fake clock is far ahead
+	fc.SetNow(time.Now().Add(48 * time.Hour))
+	_, err = trw.Write([]byte("hello"))
+	require.Nil(t, err)
+
+	files, err = filepath.Glob(filepath.Join(tmpdir, "pattern.log.*"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(files))
+}
+
+func TestTimeRollingWriterMultiProcessOption(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "multiprocess.log")
+	rw, err := NewFileRotateWriter(filename)
+	require.Nil(t, err)
+	defer rw.Close()
+
+	_, err = NewTimeRollingWriter(filename, &TimeRollingWriterOption{
+		RotateWriter: rw,
+		MultiProcess: true,
+	})
+	require.Equal(t, ErrMultiProcessUnsupported, err)
+
+	trw, err := NewTimeRollingWriter(filename, &TimeRollingWriterOption{
+		FilenamePattern: filepath.Join(tmpdir, "multiprocess.log.%Y-%m-%d_%H"),
+		MultiProcess:    true,
+	})
+	require.Nil(t, err)
+	_, err = trw.Write([]byte("hello"))
+	require.Nil(t, err)
+	require.Nil(t, trw.Close())
+
+	_, err = os.Stat(filename + ".lock")
+	require.Nil(t, err)
+}
+
+func TestTimeRollingWriterRotationTimeLocation(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	// the daily files roll at the local midnight
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	filename := filepath.Join(tmpdir, "location.log")
+	fc := &FakeClocker{}
+	fc.SetNow(time.Date(2020, 1, 2, 7, 0, 0, 0, loc))
+
+	trw, err := NewTimeRollingWriter(filename, &TimeRollingWriterOption{
+		Clocker:         fc,
+		FilenamePattern: filepath.Join(tmpdir, "location.log.%Y%m%d%H"),
+		RotationTime:    24 * time.Hour,
+	})
+	require.Nil(t, err)
+	defer trw.Close()
+
+	for _, tc := range []struct {
+		now  time.Time
+		link string
+	}{
+		{time.Date(2020, 1, 2, 7, 0, 0, 0, loc), "location.log.2020010200"},
+		{time.Date(2020, 1, 2, 9, 0, 0, 0, loc), "location.log.2020010200"},
+		{time.Date(2020, 1, 2, 23, 59, 0, 0, loc), "location.log.2020010200"},
+		{time.Date(2020, 1, 3, 0, 1, 0, 0, loc), "location.log.2020010300"},
+	} {
+		fc.SetNow(tc.now)
+		_, err = trw.Write([]byte("hello"))
+		require.Nil(t, err)
+
+		link, err := os.Readlink(filename)
+		require.Nil(t, err)
+		require.Equal(t, tc.link, link)
+	}
+}
+
+func TestTimeRollingWriterMaxAgeKeepsLockFile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("./testdata/testlog", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "app.log")
+	fc := &FakeClocker{}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	fc.SetNow(now)
+
+	// the glob app.log.* matches the lock file
+	trw, err := NewTimeRollingWriter(filename, &TimeRollingWriterOption{
+		Clocker:         fc,
+		FilenamePattern: filepath.Join(tmpdir, "app.log.%Y%m%d"),
+		MaxAge:          24 * time.Hour,
+		MultiProcess:    true,
+	})
+	require.Nil(t, err)
+	defer trw.Close()
+
+	_, err = trw.Write([]byte("hello"))
+	require.Nil(t, err)
+
+	old := now.Add(-48 * time.Hour)
+	require.Nil(t, os.Chtimes(filename+".lock", old, old))
+
+	fc.SetNow(now.Add(72 * time.Hour))
+	_, err = trw.Write([]byte("hello"))
+	require.Nil(t, err)
+
+	_, err = os.Stat(filename + ".lock")
+	require.Nil(t, err)
+}
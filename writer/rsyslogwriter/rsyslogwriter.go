@@ -60,13 +60,15 @@ package rsyslogwriter
 // BOM             = %xEF.BB.BF
 
 import (
-	"bytes"
 	"errors"
 	"net"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/sofastack/sofa-common-go/syncpool/bytespool"
+	"github.com/sofastack/sofa-common-go/writer/framer"
 )
 
 var hostname string
@@ -194,7 +196,6 @@ type RsyslogWriter struct {
 	option *Option
 	pri    string
 	pid    string
-	buffer bytes.Buffer
 	conn   *net.UDPConn
 }
 
@@ -204,6 +205,7 @@ type Option struct {
 	appname  string
 	severity Severity
 	facility Facility
+	framer   framer.LineFramer
 }
 
 func NewOption() *Option {
@@ -218,6 +220,9 @@ func (o *Option) SetAppname(s string) *Option    { o.appname = s; return o }
 func (o *Option) SetSeverity(s Severity) *Option { o.severity = s; return o }
 func (o *Option) SetFacility(s Facility) *Option { o.facility = s; return o }
 
+// SetLineFramer sets the framer which frames the MSG part before writing.
+func (o *Option) SetLineFramer(f framer.LineFramer) *Option { o.framer = f; return o }
+
 func New(o *Option) (*RsyslogWriter, error) {
 	dstAddr, err := net.ResolveUDPAddr("udp4", o.server)
 	if err != nil {
@@ -247,24 +252,36 @@ func New(o *Option) (*RsyslogWriter, error) {
 func (rs *RsyslogWriter) Write(p []byte) (int, error) {
 	// RFC5424
 	// <165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 appname - - It's time to make the do-nuts
-	b := rs.buffer
-
-	b.Reset()
-	b.WriteString("<")
-	b.WriteString(rs.pri)
-	b.WriteString(">1 ")
-	b.WriteString(time.Now().Format(time.RFC3339))
-	b.WriteString(" ")
-	b.WriteString(rs.option.hostname)
-	b.WriteString(" ")
-	b.WriteString(rs.option.appname)
-	b.WriteString(" ")
-	b.WriteString(rs.pid)
-	b.WriteString(" -") // No msg id
-	b.WriteString(" ")
-	b.Write(p)
-
-	return rs.conn.Write(b.Bytes())
+	// the packet is built in a pooled buffer per call since the writer is shared by goroutines
+	b := bytespool.AcquireBytes()
+	defer bytespool.ReleaseBytes(b)
+	now := time.Now()
+
+	buf := append((*b)[:0], '<')
+	buf = append(buf, rs.pri...)
+	buf = append(buf, ">1 "...)
+	buf = now.AppendFormat(buf, time.RFC3339)
+	buf = append(buf, ' ')
+	buf = append(buf, rs.option.hostname...)
+	buf = append(buf, ' ')
+	buf = append(buf, rs.option.appname...)
+	buf = append(buf, ' ')
+	buf = append(buf, rs.pid...)
+	buf = append(buf, " -"...) // No msg id
+	buf = append(buf, ' ')
+	if rs.option.framer != nil {
+		buf = rs.option.framer.Frame(buf, p, now)
+	} else {
+		buf = append(buf, p...)
+	}
+	*b = buf
+
+	// report the bytes of p instead of the packet thus the callers resuming from the
+	// short write do not skip the following data
+	if _, err := rs.conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
 func (rs *RsyslogWriter) Close() error {
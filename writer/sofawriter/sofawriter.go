@@ -20,13 +20,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"time"
 
-	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
+	"go.uber.org/multierr"
 
 	"github.com/sofastack/sofa-common-go/writer/asyncwriter"
 	"github.com/sofastack/sofa-common-go/writer/dsn"
+	"github.com/sofastack/sofa-common-go/writer/pipeline"
 	"github.com/sofastack/sofa-common-go/writer/rollingwriter"
 	"github.com/sofastack/sofa-common-go/writer/rsyslogwriter"
 	"github.com/sofastack/sofa-common-go/writer/testwriter"
@@ -36,6 +37,91 @@ type Writer struct {
 	dsn     *dsn.DSN
 	dsnlist *dsn.DSNList
 	w       io.Writer
+	dests   []*Destination
+}
+
+// Destination is the writer built from a DSN.
+type Destination struct {
+	dsn     *dsn.DSN
+	w       io.Writer
+	inner   io.Writer // the writer which is not wrapped by disk guard
+	base    io.Writer
+	watcher *rollingwriter.Watcher
+}
+
+func newDestination(d *dsn.DSN) (*Destination, error) {
+	w, base, err := newWriter(d)
+	if err != nil {
+		return nil, err
+	}
+
+	dest := &Destination{
+		dsn:     d,
+		w:       newDiskGuard(d, w, base),
+		inner:   w,
+		base:    base,
+		watcher: newWatcher(d, base),
+	}
+	if dest.watcher != nil {
+		dest.watcher.Start()
+	}
+
+	return dest, nil
+}
+
+func (d *Destination) GetDSN() *dsn.DSN { return d.dsn }
+
+// GetHistograms returns the histograms of the async writer, it's nil unless
+// the destination is async and enables the histograms.
+func (d *Destination) GetHistograms() *pipeline.Histograms {
+	if aw, ok := d.inner.(*asyncwriter.AsyncWriter); ok {
+		return aw.GetHistograms()
+	}
+	return nil
+}
+
+func (d *Destination) Write(p []byte) (int, error) { return d.w.Write(p) }
+
+// WriteLevel writes the record with its level thus the disk guard drops the low level
+// records, see rollingwriter.LevelWriter.
+func (d *Destination) WriteLevel(level int8, p []byte) (int, error) {
+	if lw, ok := d.w.(rollingwriter.LevelWriter); ok {
+		return lw.WriteLevel(level, p)
+	}
+	return d.w.Write(p)
+}
+
+func (d *Destination) Close() error {
+	if d.watcher != nil {
+		d.watcher.Stop()
+	}
+
+	if c, ok := d.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Reopen reopens the underlying file if it supports reopening.
+func (d *Destination) Reopen() error {
+	if r, ok := d.base.(rollingwriter.Reopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
+// multiWriter writes to all destinations even if some of them failed.
+type multiWriter []*Destination
+
+func (mw multiWriter) Write(p []byte) (int, error) {
+	var errs []error
+	for i := range mw {
+		if _, err := mw[i].Write(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return len(p), multierr.Combine(errs...)
 }
 
 func New(writers ...io.Writer) *Writer {
@@ -52,7 +138,16 @@ func (w *Writer) GetDSN() *dsn.DSN {
 	return w.dsn
 }
 
+// GetDestinations returns the destinations built from DSN or DSNList.
+func (w *Writer) GetDestinations() []*Destination {
+	return w.dests
+}
+
 func (w *Writer) Close() error {
+	if w.dests != nil {
+		return closeDestinations(w.dests)
+	}
+
 	if rw, ok := w.w.(io.Closer); ok {
 		return rw.Close()
 	}
@@ -61,6 +156,29 @@ func (w *Writer) Close() error {
 
 func (w *Writer) Write(p []byte) (int, error) { return w.w.Write(p) }
 
+// Reopen reopens the underlying files which support reopening.
+func (w *Writer) Reopen() error {
+	var errs []error
+	for i := range w.dests {
+		if err := w.dests[i].Reopen(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return multierr.Combine(errs...)
+}
+
+func closeDestinations(dests []*Destination) error {
+	var errs []error
+	for i := range dests {
+		if err := dests[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return multierr.Combine(errs...)
+}
+
 func NewFromDSNString(d string) (*Writer, error) {
 	n, err := dsn.NewDSN(d)
 	if err != nil {
@@ -71,54 +189,62 @@ func NewFromDSNString(d string) (*Writer, error) {
 }
 
 func NewFromDSN(d *dsn.DSN) (*Writer, error) {
-	w, err := newWriter(d)
+	dest, err := newDestination(d)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Writer{
-		dsn: d,
-		w:   w,
+		dsn:   d,
+		w:     dest,
+		dests: []*Destination{dest},
 	}, nil
 }
 
+// NewFromDSNList returns a writer which writes to every destination of dsnlist,
+// the failure of one destination does not stop writing to the others.
 func NewFromDSNList(dsnlist *dsn.DSNList) (*Writer, error) {
-	var w io.Writer
-	dl := dsnlist.Get()
-	if len(dl) == 0 {
-		w = ioutil.Discard
-	} else if len(dl) > 1 {
-		writers := make([]io.Writer, 0, len(dl))
-		for i := range dl {
-			nw, err := newWriter(dl[i])
-			if err != nil {
-				return nil, err
-			}
-			writers = append(writers, nw)
-		}
-		w = io.MultiWriter(writers...)
+	sw := &Writer{
+		dsnlist: dsnlist,
+	}
 
-	} else {
-		nw, err := newWriter(dl[0])
+	dl := dsnlist.Get()
+	sw.dests = make([]*Destination, 0, len(dl))
+	for i := range dl {
+		dest, err := newDestination(dl[i])
 		if err != nil {
+			// nolint
+			closeDestinations(sw.dests)
 			return nil, err
 		}
-		w = nw
+		sw.dests = append(sw.dests, dest)
 	}
 
-	return &Writer{
-		dsnlist: dsnlist,
-		w:       w,
-	}, nil
+	switch len(sw.dests) {
+	case 0:
+		sw.w = ioutil.Discard
+	case 1:
+		sw.w = sw.dests[0]
+	default:
+		sw.w = multiWriter(sw.dests)
+	}
+
+	return sw, nil
 }
 
-func newWriter(d *dsn.DSN) (io.Writer, error) {
+// newWriter returns the writer built from the dsn and the base writer which
+// is not wrapped by async writer.
+func newWriter(d *dsn.DSN) (io.Writer, io.Writer, error) {
+	if err := dsn.Validate(d); err != nil {
+		return nil, nil, err
+	}
+
 	var w io.Writer
 	switch d.GetScheme() {
 	case "", "file", "unix":
 		rw, err := newRollingWriter(d)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		w = rw
 	case "rsyslog", "syslog":
@@ -133,21 +259,23 @@ func newWriter(d *dsn.DSN) (io.Writer, error) {
 
 		rw, err := rsyslogwriter.New(option)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		w = rw
 	case "test":
 		tw, _, err := testwriter.New(d)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		w = tw
 
 	default:
-		return nil, errors.New("unknown scheme type")
+		return nil, nil, errors.New("unknown scheme type")
 	}
 
+	base := w
+
 	async := d.GetQuery(dsn.AsyncKey)
 	if len(async) > 0 {
 		option := asyncwriter.NewOption().
@@ -159,21 +287,79 @@ func newWriter(d *dsn.DSN) (io.Writer, error) {
 		if dsn.ParseBool(d.GetQuery(dsn.AsyncBlockKey), false) {
 			option.AllowBlockForever()
 		}
+		if strings.EqualFold(d.GetQuery(dsn.AsyncQueueKey), "sharded") {
+			option.SetQueueMode(asyncwriter.ShardedQueue)
+		}
+		if dsn.ParseBool(d.GetQuery(dsn.AsyncHistogramsKey), false) {
+			option.EnableHistograms()
+		}
 		var err error
 		w, err = asyncwriter.New(w, asyncwriter.WithAsyncWriterOption(option))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
-	return w, nil
+	return w, base, nil
+}
+
+// newDiskGuard wraps the writer of file by the disk guard if the dsn sets the min free space
+// or inodes, the base writer names the backups to delete.
+func newDiskGuard(d *dsn.DSN, w, base io.Writer) io.Writer {
+	switch d.GetScheme() {
+	case "", "file", "unix":
+	default:
+		return w
+	}
+
+	minFree := dsn.ParseSize(d.GetQuery(dsn.DiskMinFreeKey), dsn.MiB, 0)
+	minFreeInodes := dsn.ParseInt64(d.GetQuery(dsn.DiskMinFreeInodesKey), 0)
+	if minFree <= 0 && minFreeInodes <= 0 {
+		return w
+	}
+
+	option := rollingwriter.NewDiskGuardOption().
+		SetMinFreeBytes(uint64(minFree)).
+		SetMinFreeInodes(uint64(minFreeInodes))
+	if dsn.ParseBool(d.GetQuery(dsn.DiskDeleteBackupsKey), false) {
+		if bg, ok := base.(rollingwriter.BackupGlobber); ok {
+			option.EnableDeleteBackups(bg.BackupGlob())
+		}
+	}
+	if dsn.ParseBool(d.GetQuery(dsn.DiskDropLowLevelKey), false) {
+		option.EnableDropLowLevel()
+	}
+
+	return rollingwriter.NewDiskGuard(w, d.GetPath(), option)
+}
+
+// newWatcher returns the watcher which reopens the file once it was moved or removed if the dsn
+// sets the interval of reopen watch, it's nil unless the base writer is a file.
+func newWatcher(d *dsn.DSN, base io.Writer) *rollingwriter.Watcher {
+	switch d.GetScheme() {
+	case "", "file", "unix":
+	default:
+		return nil
+	}
+
+	interval := dsn.ParseDuration(d.GetQuery(dsn.ReopenWatchKey), 0)
+	if interval <= 0 {
+		return nil
+	}
+
+	r, ok := base.(rollingwriter.Reopener)
+	if !ok {
+		return nil
+	}
+
+	return rollingwriter.NewWatcher(d.GetPath(), r, interval)
 }
 
 // newRollingWriter returns a log writer that rotates log files either
-// by size or by time according to given rotation mode.
+// by size or by time according to given rotation mode (case-insensitive as the schema).
 func newRollingWriter(d *dsn.DSN) (io.WriteCloser, error) {
 	mode := d.GetQuery(dsn.RotateMode)
-	switch mode {
+	switch strings.ToLower(mode) {
 	case "size":
 		return newSizeRotationWriter(d)
 	case "time":
@@ -188,9 +374,15 @@ func newRollingWriter(d *dsn.DSN) (io.WriteCloser, error) {
 // newSizeRotationWriter returns a log writer that rotates log files by size.
 func newSizeRotationWriter(d *dsn.DSN) (io.WriteCloser, error) {
 	option := rollingwriter.NewOption()
-	option.SetMaxSize(int(dsn.ParseInt64(d.GetQuery(dsn.MaxSizeKey), 0)))
-	option.SetMaxAge(int(dsn.ParseInt64(d.GetQuery(dsn.MaxAgeKey), 0)))
+	// lumberjack accepts megabytes and days only, round up to avoid falling back to its default
+	maxsize := dsn.ParseSize(d.GetQuery(dsn.MaxSizeKey), dsn.MiB, 0)
+	option.SetMaxSize(int((maxsize + dsn.MiB - 1) / dsn.MiB))
+	maxage := dsn.ParseDays(d.GetQuery(dsn.MaxAgeKey), 0)
+	option.SetMaxAge(int((maxage + dsn.Day - 1) / dsn.Day))
 	option.SetMaxBackups(int(dsn.ParseInt64(d.GetQuery(dsn.MaxBackupsKey), 0)))
+	if dsn.ParseBool(d.GetQuery(dsn.MultiProcessKey), false) {
+		option.EnableMultiProcess()
+	}
 	return rollingwriter.New(d.GetPath(), option), nil
 }
 
@@ -208,56 +400,40 @@ func newTimeRotationWriter(d *dsn.DSN) (io.WriteCloser, error) {
 		pattern = filepath.Join(filepath.Dir(fname), fp)
 	}
 
-	maxAge := 7 * 24 * time.Hour
-	iMaxAge := dsn.ParseInt64(d.GetQuery(dsn.MaxAgeKey), 0)
-	if iMaxAge != 0 {
-		maxAge = time.Duration(iMaxAge) * time.Hour * 24
+	maxAge := dsn.ParseDays(d.GetQuery(dsn.MaxAgeKey), 0)
+	if maxAge == 0 {
+		maxAge = 7 * dsn.Day
 	}
 
 	if err := makeParentDirectory(fname); err != nil {
 		return nil, err
 	}
 
-	return rotatelogs.New(
-		pattern,
-		rotatelogs.WithLinkName(fname),
-		rotatelogs.WithRotationTime(rtime),
-		rotatelogs.WithMaxAge(maxAge),
-	)
+	return rollingwriter.NewTimeRollingWriter(fname, &rollingwriter.TimeRollingWriterOption{
+		FilenamePattern: pattern,
+		RotationTime:    rtime,
+		MaxAge:          maxAge,
+		MultiProcess:    dsn.ParseBool(d.GetQuery(dsn.MultiProcessKey), false),
+	})
 }
 
-// rotateTime returns rotation duration according to t.
-// t must be in format of "2m", "1h", "1d", units are minute, hour and day separately.
+// rotateTime returns rotation duration according to t, e.g. "30m", "1h", "1d" or "1h30m".
 // If t is empty, default to 1 hour.
 func rotateTime(t string) (time.Duration, error) {
 	if len(t) == 0 {
 		return time.Hour, nil
 	}
 
-	if len(t) == 1 {
-		return 0, fmt.Errorf("invalid rotation time %s", t)
-	}
-
-	var (
-		num  = t[:len(t)-1]
-		unit = t[len(t)-1:]
-	)
-	i, err := strconv.Atoi(num)
+	d, err := dsn.ParseDurationUnit(t, 0)
 	if err != nil {
 		return 0, fmt.Errorf("invalid rotation time %s: %v", t, err)
 	}
 
-	d := time.Duration(i)
-	switch unit {
-	case "m":
-		return d * time.Minute, nil
-	case "h":
-		return d * time.Hour, nil
-	case "d":
-		return d * time.Hour * 24, nil
-	default:
-		return 0, fmt.Errorf("invalid rotation time %s, unsupported time unit %s", t, unit)
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid rotation time %s: must be positive", t)
 	}
+
+	return d, nil
 }
 
 //nolint
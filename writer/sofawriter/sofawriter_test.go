@@ -1,12 +1,20 @@
 package sofawriter
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/sofastack/sofa-common-go/writer/dsn"
+	"github.com/sofastack/sofa-common-go/writer/rollingwriter"
 )
 
 // TODO(yingming.dhw) need test cases for rsyslog and syslog.
@@ -37,10 +45,62 @@ func TestNewFromDSNString(t *testing.T) {
 			dsn: fmt.Sprintf("%s?rotate_mode=time&maxage=7&rotate_time=1h", fname),
 			ok:  true,
 		},
+		{
+			dsn: fmt.Sprintf("%s?rotate_mode=TIME&rotate_time=1h", fname),
+			ok:  true,
+		},
+		{
+			dsn: fmt.Sprintf("%s?rotate_mode=Size&compress=true", fname),
+			ok:  true,
+		},
+		{
+			dsn: fmt.Sprintf("%s?multi_process=true", fname),
+			ok:  true,
+		},
+		{
+			dsn: fmt.Sprintf("%s?rotate_mode=time&multi_process=true", fname),
+			ok:  true,
+		},
 		{
 			dsn: fmt.Sprintf("%s?rotate_mode=blaa", fname),
 			ok:  false,
 		},
+		{
+			dsn: fmt.Sprintf("%s?maxsize=10XB", fname),
+			ok:  false,
+		},
+		{
+			dsn: fmt.Sprintf("%s?rotate_mod=time", fname),
+			ok:  false,
+		},
+		{
+			dsn: fmt.Sprintf("%s?rotate_mode=time&maxage=7&maxbackups=7", fname),
+			ok:  false,
+		},
+		{
+			dsn: fmt.Sprintf("%s?rotate_mod=time&lenient=true", fname),
+			ok:  true,
+		},
+		{
+			dsn: fmt.Sprintf("%s?rotate_mode=size&maxsize=512MiB&maxage=1w", fname),
+			ok:  true,
+		},
+		{
+			dsn: fmt.Sprintf("%s?rotate_mode=time&maxage=36h&rotate_time=90s", fname),
+			ok:  true,
+		},
+		{
+			dsn: fmt.Sprintf("%s?async=true&async_queue=sharded", fname),
+			ok:  true,
+		},
+		{
+			dsn: fmt.Sprintf("%s?async=true&async_queue=ring", fname),
+			ok:  false,
+		},
+		{
+			dsn: fmt.Sprintf("%s?rotate_mode=&maxsize=&compress=", fname),
+			ok:  true,
+		},
 	}
 	for i, c := range cases {
 		w, err := NewFromDSNString(c.dsn)
@@ -84,7 +144,26 @@ func TestRotateTime(t *testing.T) {
 			ok: false,
 		},
 		{
-			s:  "500s", // unsupported unit
+			s:  "500s",
+			d:  500 * time.Second,
+			ok: true,
+		},
+		{
+			s:  "1w",
+			d:  7 * 24 * time.Hour,
+			ok: true,
+		},
+		{
+			s:  "1h30m",
+			d:  90 * time.Minute,
+			ok: true,
+		},
+		{
+			s:  "0m",
+			ok: false,
+		},
+		{
+			s:  "5y", // unsupported unit
 			ok: false,
 		},
 		{
@@ -102,3 +181,137 @@ func TestRotateTime(t *testing.T) {
 		}
 	}
 }
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) { return 0, errors.New("unreachable") }
+
+func TestMultiWriterIsolation(t *testing.T) {
+	assert := assert.New(t)
+
+	var b1, b2 bytes.Buffer
+	mw := multiWriter{
+		{w: &b1},
+		{w: errWriter{}},
+		{w: &b2},
+	}
+
+	n, err := mw.Write([]byte("hello"))
+	assert.Equal(5, n)
+	assert.NotNil(err)
+	assert.Equal("hello", b1.String())
+	assert.Equal("hello", b2.String())
+}
+
+func TestNewFromDSNList(t *testing.T) {
+	assert := assert.New(t)
+
+	dl, err := dsn.NewDSNList("test:///dl-a?level=error,test:///dl-b?level=debug", ",")
+	assert.Nil(err)
+
+	w, err := NewFromDSNList(dl)
+	assert.Nil(err)
+	assert.Nil(w.GetDSN())
+	assert.Len(w.GetDestinations(), 2)
+	assert.Equal("error", w.GetDestinations()[0].GetDSN().GetQuery(dsn.LevelKey))
+	assert.Equal("debug", w.GetDestinations()[1].GetDSN().GetQuery(dsn.LevelKey))
+
+	dl, err = dsn.NewDSNList("test:///dl-c,test:///dl-d?unknown=1", ",")
+	assert.Nil(err)
+	_, err = NewFromDSNList(dl)
+	assert.NotNil(err)
+}
+
+func TestDestinationDiskGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "sofawriter")
+	assert.Nil(err)
+	defer os.RemoveAll(tmpdir)
+
+	// the disk is always lower than the min free thus the low level records are dropped
+	fname := filepath.Join(tmpdir, "guard.log")
+	w, err := NewFromDSNString(fmt.Sprintf("file://%s?disk_min_free=1000000000GiB&disk_drop_low_level=true&disk_delete_backups=true", fname))
+	assert.Nil(err)
+	defer w.Close()
+
+	dest := w.GetDestinations()[0]
+	_, ok := dest.w.(*rollingwriter.DiskGuard)
+	assert.True(ok)
+
+	_, err = dest.WriteLevel(rollingwriter.InfoLevel, []byte("info\n"))
+	assert.Nil(err)
+	_, err = dest.WriteLevel(rollingwriter.InfoLevel+2, []byte("error\n"))
+	assert.Nil(err)
+
+	b, err := ioutil.ReadFile(fname)
+	assert.Nil(err)
+	assert.Equal("error\n", string(b))
+}
+
+func TestDestinationReopenWatch(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "sofawriter")
+	assert.Nil(err)
+	defer os.RemoveAll(tmpdir)
+
+	fname := filepath.Join(tmpdir, "watch.log")
+	w, err := NewFromDSNString(fmt.Sprintf("file://%s?reopen_watch=10ms", fname))
+	assert.Nil(err)
+
+	dest := w.GetDestinations()[0]
+	assert.NotNil(dest.watcher)
+
+	_, err = w.Write([]byte("a\n"))
+	assert.Nil(err)
+	// the watcher learns the file created by the first write
+	_, err = dest.watcher.Check()
+	assert.Nil(err)
+
+	// the file moved away by logrotate is reopened by the watcher thus the later writes
+	// create the file again
+	assert.Nil(os.Rename(fname, fname+".1"))
+	assert.Eventually(func() bool {
+		_, err := w.Write([]byte("b\n"))
+		assert.Nil(err)
+		_, err = os.Stat(fname)
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	b, err := ioutil.ReadFile(fname)
+	assert.Nil(err)
+	assert.Equal("b\n", string(b))
+	b, err = ioutil.ReadFile(fname + ".1")
+	assert.Nil(err)
+	assert.True(strings.HasPrefix(string(b), "a\n"))
+
+	// the watcher is stopped once closed
+	assert.Nil(w.Close())
+	w, err = NewFromDSNString(fmt.Sprintf("file://%s", fname))
+	assert.Nil(err)
+	defer w.Close()
+	assert.Nil(w.GetDestinations()[0].watcher)
+}
+
+func TestNewFromDSNSecret(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "sofawriter")
+	assert.Nil(err)
+	defer os.RemoveAll(tmpdir)
+
+	tokenfile := filepath.Join(tmpdir, "token")
+	assert.Nil(ioutil.WriteFile(tokenfile, []byte("s3cr3t\n"), 0600))
+
+	// the secrets pass the validation without lenient=true
+	d, err := dsn.NewDSN("test:///secret?discard=true&tls_key=abc&token=file:" + tokenfile)
+	assert.Nil(err)
+	w, err := NewFromDSN(d)
+	assert.Nil(err)
+	assert.Equal("s3cr3t", w.GetDSN().GetQuery("token"))
+
+	// the other keys are still validated
+	_, err = NewFromDSNString("test:///secret?token=file:" + tokenfile + "&discard=maybe")
+	assert.NotNil(err)
+}